@@ -3,8 +3,20 @@ package main
 import (
 	"dvpn/controllers"
 	"dvpn/core"
+	"dvpn/internal/address"
+	"dvpn/internal/aggregates"
+	"dvpn/internal/banpolicy"
+	"dvpn/internal/clientip"
+	"dvpn/internal/feegrant"
+	"dvpn/internal/i18n"
 	planwizardAPI "dvpn/internal/planwizard"
+	"dvpn/internal/pow"
+	"dvpn/internal/products"
+	"dvpn/internal/protocols"
 	sentinelAPI "dvpn/internal/sentinel"
+	"dvpn/internal/snapshot"
+	"dvpn/internal/versionpolicy"
+	"dvpn/internal/walletauth"
 	"dvpn/jobs"
 	"dvpn/models"
 	"dvpn/routers"
@@ -24,19 +36,68 @@ func main() {
 		panic(err)
 	}
 
+	walletBackfills := core.PlanWalletBackfills(db)
+
 	err = db.Debug().AutoMigrate(
 		&models.Country{},
 		&models.City{},
 		&models.Server{},
+		&models.ServerRemoteIP{},
 		&models.Network{},
 		&models.Wallet{},
 		&models.Purchase{},
+		&models.RevenueCatEvent{},
+		&models.Product{},
+		&models.ProductOverride{},
+		&models.StoreSubscription{},
+		&models.CountryTranslation{},
+		&models.CityTranslation{},
+		&models.WalletFavorite{},
+		&models.WalletRecent{},
+		&models.WalletPreferences{},
+		&models.ConnectionReport{},
+		&models.ServerReliability{},
+		&models.CatalogRevision{},
+		&models.CatalogEntry{},
+		&models.CountryAggregate{},
+		&models.CityAggregate{},
+		&models.RegistrationRejection{},
+		&models.RegistrationChallenge{},
+		&models.UsedWalletSignature{},
+		&models.BlockedSubnet{},
+		&models.WalletRevocation{},
+		&models.PlanSubscription{},
+		&models.Referral{},
+		&models.VoucherBatch{},
+		&models.Voucher{},
+		&models.VoucherRedemption{},
+		&models.TrialGrant{},
 	)
 	if err != nil {
 		panic(err)
 	}
 
-	err = core.PopulateDB(db)
+	err = walletBackfills.Run(db)
+	if err != nil {
+		panic(err)
+	}
+
+	err = core.HashTrialGrantAddresses(db)
+	if err != nil {
+		panic(err)
+	}
+
+	err = core.DropServerRemoteIP(db)
+	if err != nil {
+		panic(err)
+	}
+
+	languages, err := i18n.ParseLanguages(os.Getenv("SUPPORTED_LANGUAGES"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = core.PopulateDB(db, languages)
 	if err != nil {
 		panic(err)
 	}
@@ -52,6 +113,64 @@ func main() {
 		panic(err)
 	}
 
+	trustedProxies, err := clientip.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		panic(err)
+	}
+
+	clientIPResolver := &clientip.Resolver{
+		TrustedProxies: trustedProxies,
+	}
+
+	registrationLimits := controllers.RegistrationLimits{
+		Window: 24 * time.Hour,
+	}
+
+	if os.Getenv("REGISTRATION_MAX_PER_IP") != "" {
+		registrationLimits.MaxPerIP, err = strconv.ParseInt(os.Getenv("REGISTRATION_MAX_PER_IP"), 10, 64)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if os.Getenv("REGISTRATION_MAX_PER_SUBNET") != "" {
+		registrationLimits.MaxPerSubnet, err = strconv.ParseInt(os.Getenv("REGISTRATION_MAX_PER_SUBNET"), 10, 64)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if os.Getenv("REGISTRATION_LIMIT_WINDOW") != "" {
+		registrationLimits.Window, err = time.ParseDuration(os.Getenv("REGISTRATION_LIMIT_WINDOW"))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	var registrationChallenges *pow.Issuer
+	if os.Getenv("REGISTRATION_POW_DIFFICULTY") != "" {
+		difficulty, err := strconv.Atoi(os.Getenv("REGISTRATION_POW_DIFFICULTY"))
+		if err != nil {
+			panic(err)
+		}
+
+		if difficulty < 0 || difficulty > 64 {
+			panic("REGISTRATION_POW_DIFFICULTY must be between 0 and 64")
+		}
+
+		if difficulty > 0 {
+			if os.Getenv("REGISTRATION_POW_SECRET") == "" {
+				panic("REGISTRATION_POW_SECRET is required when proof of work is enabled")
+			}
+
+			registrationChallenges = &pow.Issuer{
+				Secret:     []byte(os.Getenv("REGISTRATION_POW_SECRET")),
+				Difficulty: difficulty,
+				TTL:        10 * time.Minute,
+			}
+		}
+	}
+
 	planWizardPlanID, err := strconv.ParseInt(os.Getenv("PLANWIZARD_PLAN_ID"), 10, 64)
 	if err != nil {
 		panic(err)
@@ -67,13 +186,31 @@ func main() {
 		panic(err)
 	}
 
+	addressPrefixes := address.ParsePrefixes(os.Getenv("ADDRESS_PREFIX_ACCOUNT"), os.Getenv("ADDRESS_PREFIX_NODE"), os.Getenv("ADDRESS_PREFIX_PROVIDER"))
+
+	feeGranterWalletAddress := os.Getenv("SENTINEL_FEE_GRANTER_WALLET_ADDRESS")
+	if feeGranterWalletAddress != "" {
+		feeGranterWalletAddress, err = addressPrefixes.NormalizeAccount(feeGranterWalletAddress)
+		if err != nil {
+			panic("invalid SENTINEL_FEE_GRANTER_WALLET_ADDRESS: " + err.Error())
+		}
+	}
+
+	purchaseWalletAddress := os.Getenv("SENTINEL_PURCHASE_WALLET_ADDRESS")
+	if purchaseWalletAddress != "" {
+		purchaseWalletAddress, err = addressPrefixes.NormalizeAccount(purchaseWalletAddress)
+		if err != nil {
+			panic("invalid SENTINEL_PURCHASE_WALLET_ADDRESS: " + err.Error())
+		}
+	}
+
 	sentinel := &sentinelAPI.Sentinel{
 		APIEndpoint:              os.Getenv("SENTINEL_API_ENDPOINT"),
 		RPCEndpoint:              os.Getenv("SENTINEL_RPC_ENDPOINT"),
 		ProviderPlanBlockchainID: os.Getenv("SENTINEL_PROVIDER_PLAN_ID"),
-		FeeGranterWalletAddress:  os.Getenv("SENTINEL_FEE_GRANTER_WALLET_ADDRESS"),
+		FeeGranterWalletAddress:  feeGranterWalletAddress,
 		FeeGranterMnemonic:       os.Getenv("SENTINEL_FEE_GRANTER_WALLET_MNEMONIC"),
-		PurchaseWalletAddress:    os.Getenv("SENTINEL_PURCHASE_WALLET_ADDRESS"),
+		PurchaseWalletAddress:    purchaseWalletAddress,
 		PurchaseMnemonic:         os.Getenv("SENTINEL_PURCHASE_WALLET_MNEMONIC"),
 		DefaultDenom:             os.Getenv("SENTINEL_DEFAULT_DENOM"),
 		ChainID:                  os.Getenv("SENTINEL_CHAIN_ID"),
@@ -81,18 +218,261 @@ func main() {
 		GasBase:                  gasBase,
 	}
 
+	feeGrantRenewalWindow := 72 * time.Hour
+	if os.Getenv("FEE_GRANT_RENEWAL_WINDOW") != "" {
+		feeGrantRenewalWindow, err = time.ParseDuration(os.Getenv("FEE_GRANT_RENEWAL_WINDOW"))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	feeGrantInactivityPeriod := 90 * 24 * time.Hour
+	if os.Getenv("FEE_GRANT_INACTIVITY_PERIOD") != "" {
+		feeGrantInactivityPeriod, err = time.ParseDuration(os.Getenv("FEE_GRANT_INACTIVITY_PERIOD"))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	var planSubscriptionID int64
+	if os.Getenv("SENTINEL_PLAN_SUBSCRIPTION_ID") != "" {
+		planSubscriptionID, err = strconv.ParseInt(os.Getenv("SENTINEL_PLAN_SUBSCRIPTION_ID"), 10, 64)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	planAllocationBytes := os.Getenv("SENTINEL_PLAN_ALLOCATION_BYTES")
+	if planAllocationBytes == "" {
+		planAllocationBytes = "1000000000"
+	}
+
+	if _, err := strconv.ParseUint(planAllocationBytes, 10, 64); err != nil {
+		panic("invalid SENTINEL_PLAN_ALLOCATION_BYTES: " + err.Error())
+	}
+
+	var referralReferrerReward, referralRefereeReward int64
+	if os.Getenv("REFERRAL_REFERRER_REWARD") != "" {
+		referralReferrerReward, err = strconv.ParseInt(os.Getenv("REFERRAL_REFERRER_REWARD"), 10, 64)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if os.Getenv("REFERRAL_REFEREE_REWARD") != "" {
+		referralRefereeReward, err = strconv.ParseInt(os.Getenv("REFERRAL_REFEREE_REWARD"), 10, 64)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	referralMaxRewards := int64(50)
+	if os.Getenv("REFERRAL_MAX_REWARDS_PER_REFERRER") != "" {
+		referralMaxRewards, err = strconv.ParseInt(os.Getenv("REFERRAL_MAX_REWARDS_PER_REFERRER"), 10, 64)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	referralRefundWindow := 14 * 24 * time.Hour
+	if os.Getenv("REFERRAL_REFUND_WINDOW") != "" {
+		referralRefundWindow, err = time.ParseDuration(os.Getenv("REFERRAL_REFUND_WINDOW"))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	var trialPolicy *jobs.TrialPolicy
+	if os.Getenv("TRIAL_AMOUNT") != "" {
+		trialAmount, err := strconv.ParseInt(os.Getenv("TRIAL_AMOUNT"), 10, 64)
+		if err != nil {
+			panic(err)
+		}
+
+		if trialAmount > 0 {
+			if os.Getenv("TRIAL_DAILY_BUDGET") == "" {
+				panic("TRIAL_DAILY_BUDGET is required when trials are enabled")
+			}
+
+			trialDailyBudget, err := strconv.ParseInt(os.Getenv("TRIAL_DAILY_BUDGET"), 10, 64)
+			if err != nil {
+				panic(err)
+			}
+
+			if trialDailyBudget < trialAmount {
+				panic("TRIAL_DAILY_BUDGET must cover at least one trial")
+			}
+
+			trialPolicy = &jobs.TrialPolicy{
+				Amount:      trialAmount,
+				Denom:       sentinel.DefaultDenom,
+				DailyBudget: trialDailyBudget,
+			}
+		}
+	}
+
+	feeGrantPolicies, err := feegrant.LoadPolicies(os.Getenv("FEE_GRANT_POLICIES_PATH"))
+	if err != nil {
+		panic(err)
+	}
+
+	protocolRegistry, err := protocols.Load(os.Getenv("PROTOCOLS_PATH"))
+	if err != nil {
+		panic(err)
+	}
+
+	versionPolicy := &versionpolicy.Policy{
+		Rules: make(map[models.ServerProtocol]versionpolicy.Rule),
+	}
+
+	for _, protocol := range protocolRegistry.Protocols {
+		rule, err := versionpolicy.ParseRule(os.Getenv("NODE_MIN_VERSION_"+string(protocol.Name)), os.Getenv("NODE_BLOCKED_VERSIONS_"+string(protocol.Name)))
+		if err != nil {
+			panic(err)
+		}
+
+		versionPolicy.Rules[protocol.Name] = rule
+	}
+
+	var banPolicy *banpolicy.Engine
+	if os.Getenv("BAN_POLICY_PATH") != "" {
+		rules, err := banpolicy.LoadRules(os.Getenv("BAN_POLICY_PATH"))
+		if err != nil {
+			panic(err)
+		}
+
+		banPolicy = &banpolicy.Engine{
+			DB:       db,
+			Logger:   logger.With("component", "ban-policy"),
+			Rules:    rules,
+			Versions: versionPolicy,
+		}
+	}
+
+	aggregatesCache := &aggregates.Cache{
+		DB:  db,
+		TTL: time.Minute,
+	}
+
+	err = aggregates.RebuildLatest(db)
+	if err != nil {
+		panic(err)
+	}
+
+	productCatalog := &products.Catalog{
+		DB:  db,
+		TTL: time.Minute,
+	}
+
+	var catalogExporter *snapshot.Exporter
+	if os.Getenv("CATALOG_SIGNING_KEY") != "" {
+		signingKey, err := snapshot.ParseSigningKey(os.Getenv("CATALOG_SIGNING_KEY"))
+		if err != nil {
+			panic(err)
+		}
+
+		var store snapshot.Store
+		switch os.Getenv("CATALOG_STORAGE") {
+		case "s3":
+			store = snapshot.S3Store{
+				Endpoint:  os.Getenv("CATALOG_S3_ENDPOINT"),
+				Region:    os.Getenv("CATALOG_S3_REGION"),
+				Bucket:    os.Getenv("CATALOG_S3_BUCKET"),
+				AccessKey: os.Getenv("CATALOG_S3_ACCESS_KEY"),
+				SecretKey: os.Getenv("CATALOG_S3_SECRET_KEY"),
+			}
+		case "", "disk":
+			store = snapshot.DiskStore{
+				Directory: os.Getenv("CATALOG_DISK_PATH"),
+			}
+		default:
+			panic("unsupported CATALOG_STORAGE " + os.Getenv("CATALOG_STORAGE"))
+		}
+
+		encoding := os.Getenv("CATALOG_ENCODING")
+		if encoding == "" {
+			encoding = snapshot.EncodingGzip
+		}
+
+		if encoding != snapshot.EncodingGzip && encoding != snapshot.EncodingZstd {
+			panic("unsupported CATALOG_ENCODING " + encoding)
+		}
+
+		catalogRetention := 10
+		if os.Getenv("CATALOG_RETENTION") != "" {
+			catalogRetention, err = strconv.Atoi(os.Getenv("CATALOG_RETENTION"))
+			if err != nil {
+				panic(err)
+			}
+		}
+
+		catalogExporter = &snapshot.Exporter{
+			DB:         db,
+			Store:      store,
+			SigningKey: signingKey,
+			Encoding:   encoding,
+			Retain:     catalogRetention,
+			CacheTTL:   5 * time.Minute,
+		}
+	}
+
 	router := routers.Router{
 		HealthController: &controllers.HealthController{
 			DB:     db,
 			Logger: logger.With("controller", "health"),
 		},
 		VPNController: &controllers.VPNController{
-			DB:     db,
-			Logger: logger.With("controller", "vpn"),
+			DB:               db,
+			Logger:           logger.With("controller", "vpn"),
+			ClientIPResolver: clientIPResolver,
+			Localizer:        i18n.NewLocalizer(languages),
+			Protocols:        protocolRegistry,
+			Aggregates:       aggregatesCache,
+			Addresses:        addressPrefixes,
 		},
 		WalletController: &controllers.WalletController{
-			DB:     db,
-			Logger: logger.With("controller", "wallet"),
+			DB:               db,
+			Logger:           logger.With("controller", "wallet"),
+			Sentinel:         sentinel,
+			Addresses:        addressPrefixes,
+			ClientIPResolver: clientIPResolver,
+			Registration:     registrationLimits,
+			Challenges:       registrationChallenges,
+			UsedChallenges:   &pow.ChallengeStore{DB: db},
+			Products:         productCatalog,
+		},
+		ProfileController: &controllers.ProfileController{
+			DB:        db,
+			Logger:    logger.With("controller", "profile"),
+			Protocols: protocolRegistry,
+			Addresses: addressPrefixes,
+		},
+		AdminController: &controllers.AdminController{
+			DB:        db,
+			Logger:    logger.With("controller", "admin"),
+			BanPolicy: banPolicy,
+			Addresses: addressPrefixes,
+			Languages: languages,
+		},
+		CatalogController: &controllers.CatalogController{
+			Logger:   logger.With("controller", "catalog"),
+			Exporter: catalogExporter,
+		},
+		VoucherController: &controllers.VoucherController{
+			DB:           db,
+			Logger:       logger.With("controller", "voucher"),
+			DefaultDenom: sentinel.DefaultDenom,
+		},
+		ProductController: &controllers.ProductController{
+			DB:           db,
+			Logger:       logger.With("controller", "product"),
+			Catalog:      productCatalog,
+			DefaultDenom: sentinel.DefaultDenom,
+		},
+		AdminAuth:       os.Getenv("ADMIN_AUTH"),
+		AddressPrefixes: addressPrefixes,
+		WalletSignatures: &walletauth.SignatureStore{
+			DB: db,
 		},
 	}
 
@@ -102,6 +482,12 @@ func main() {
 			DB:         db,
 			Logger:     logger,
 			PlanWizard: planWizard,
+			Protocols:  protocolRegistry,
+			BanPolicy:  banPolicy,
+			Catalog:    catalogExporter,
+			Aggregates: aggregatesCache,
+
+			VersionPolicy: versionPolicy,
 		}
 
 		fetchNodesFromPlanWizardScheduler := gocron.NewScheduler(time.UTC)
@@ -115,6 +501,8 @@ func main() {
 			DB:       db,
 			Logger:   logger,
 			Sentinel: sentinel,
+			Policies: feeGrantPolicies,
+			Trial:    trialPolicy,
 		}
 
 		enrollWalletsScheduler := gocron.NewScheduler(time.UTC)
@@ -124,6 +512,69 @@ func main() {
 		})
 		enrollWalletsScheduler.StartAsync()
 
+		renewFeeGrants := jobs.RenewFeeGrants{
+			DB:       db,
+			Logger:   logger,
+			Sentinel: sentinel,
+			Policies: feeGrantPolicies,
+
+			RenewalWindow:    feeGrantRenewalWindow,
+			InactivityPeriod: feeGrantInactivityPeriod,
+		}
+
+		renewFeeGrantsScheduler := gocron.NewScheduler(time.UTC)
+		renewFeeGrantsScheduler.SetMaxConcurrentJobs(1, gocron.RescheduleMode)
+		renewFeeGrantsScheduler.Every(1).Hours().Do(func() {
+			renewFeeGrants.Run()
+		})
+		renewFeeGrantsScheduler.StartAsync()
+
+		revokeInactiveFeeGrants := jobs.RevokeInactiveFeeGrants{
+			DB:       db,
+			Logger:   logger,
+			Sentinel: sentinel,
+
+			InactivityPeriod: feeGrantInactivityPeriod,
+		}
+
+		revokeInactiveFeeGrantsScheduler := gocron.NewScheduler(time.UTC)
+		revokeInactiveFeeGrantsScheduler.SetMaxConcurrentJobs(1, gocron.RescheduleMode)
+		revokeInactiveFeeGrantsScheduler.Every(6).Hours().Do(func() {
+			revokeInactiveFeeGrants.Run()
+		})
+		revokeInactiveFeeGrantsScheduler.StartAsync()
+
+		if sentinel.ProviderPlanBlockchainID != "" {
+			subscribeWallets := jobs.SubscribeWallets{
+				DB:       db,
+				Logger:   logger,
+				Sentinel: sentinel,
+
+				SubscriptionID: planSubscriptionID,
+				AllocatedBytes: planAllocationBytes,
+			}
+
+			subscribeWalletsScheduler := gocron.NewScheduler(time.UTC)
+			subscribeWalletsScheduler.SetMaxConcurrentJobs(1, gocron.RescheduleMode)
+			subscribeWalletsScheduler.Every(10).Seconds().Do(func() {
+				subscribeWallets.Run()
+			})
+			subscribeWalletsScheduler.StartAsync()
+		}
+
+		processWalletRevocations := jobs.ProcessWalletRevocations{
+			DB:       db,
+			Logger:   logger,
+			Sentinel: sentinel,
+		}
+
+		processWalletRevocationsScheduler := gocron.NewScheduler(time.UTC)
+		processWalletRevocationsScheduler.SetMaxConcurrentJobs(1, gocron.RescheduleMode)
+		processWalletRevocationsScheduler.Every(1).Minutes().Do(func() {
+			processWalletRevocations.Run()
+		})
+		processWalletRevocationsScheduler.StartAsync()
+
 		processPurchases := jobs.ProcessPurchases{
 			DB:       db,
 			Logger:   logger,
@@ -136,6 +587,50 @@ func main() {
 			processPurchases.Run()
 		})
 		processPurchasesScheduler.StartAsync()
+
+		pruneRegistrationData := jobs.PruneRegistrationData{
+			DB:     db,
+			Logger: logger,
+		}
+
+		pruneRegistrationDataScheduler := gocron.NewScheduler(time.UTC)
+		pruneRegistrationDataScheduler.SetMaxConcurrentJobs(1, gocron.RescheduleMode)
+		pruneRegistrationDataScheduler.Every(1).Hours().Do(func() {
+			pruneRegistrationData.Run()
+		})
+		pruneRegistrationDataScheduler.StartAsync()
+
+		if referralReferrerReward > 0 || referralRefereeReward > 0 {
+			processReferrals := jobs.ProcessReferrals{
+				DB:     db,
+				Logger: logger,
+
+				ReferrerReward:        referralReferrerReward,
+				RefereeReward:         referralRefereeReward,
+				Denom:                 sentinel.DefaultDenom,
+				MaxRewardsPerReferrer: referralMaxRewards,
+				RefundWindow:          referralRefundWindow,
+			}
+
+			processReferralsScheduler := gocron.NewScheduler(time.UTC)
+			processReferralsScheduler.SetMaxConcurrentJobs(1, gocron.RescheduleMode)
+			processReferralsScheduler.Every(1).Minutes().Do(func() {
+				processReferrals.Run()
+			})
+			processReferralsScheduler.StartAsync()
+		}
+
+		aggregateConnectionReports := jobs.AggregateConnectionReports{
+			DB:     db,
+			Logger: logger,
+		}
+
+		aggregateConnectionReportsScheduler := gocron.NewScheduler(time.UTC)
+		aggregateConnectionReportsScheduler.SetMaxConcurrentJobs(1, gocron.RescheduleMode)
+		aggregateConnectionReportsScheduler.Every(10).Minutes().Do(func() {
+			aggregateConnectionReports.Run()
+		})
+		aggregateConnectionReportsScheduler.StartAsync()
 	}
 
 	logger.Info("Registering routes...")
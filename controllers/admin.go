@@ -0,0 +1,606 @@
+package controllers
+
+import (
+	"dvpn/internal/address"
+	"dvpn/internal/banpolicy"
+	"dvpn/middleware"
+	"dvpn/models"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/text/language"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type AdminController struct {
+	DB        *gorm.DB
+	Logger    *zap.SugaredLogger
+	BanPolicy *banpolicy.Engine
+	Addresses address.Prefixes
+	Languages []language.Tag
+}
+
+func (ac AdminController) GetBanPolicyReport(c *gin.Context) {
+	if ac.BanPolicy == nil {
+		middleware.RespondErr(c, middleware.APIErrorNotFound, "ban policy is not configured")
+		return
+	}
+
+	changes, err := ac.BanPolicy.Evaluate()
+	if err != nil {
+		reason := "failed to evaluate ban policy: " + err.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		ac.Logger.Error(reason)
+		return
+	}
+
+	middleware.RespondOK(c, gin.H{
+		"rules":   ac.BanPolicy.Rules,
+		"changes": changes,
+	})
+}
+
+func (ac AdminController) GetBlockedSubnets(c *gin.Context) {
+	var subnets []models.BlockedSubnet
+	tx := ac.DB.Order("id").Find(&subnets)
+	if tx.Error != nil {
+		reason := "failed to get blocked subnets: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		ac.Logger.Error(reason)
+		return
+	}
+
+	middleware.RespondOK(c, subnets)
+}
+
+func (ac AdminController) BlockSubnet(c *gin.Context) {
+	type requestPayload struct {
+		Subnet string `json:"subnet"`
+		Reason string `json:"reason"`
+	}
+
+	var payload requestPayload
+	if err := c.BindJSON(&payload); err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid request payload: "+err.Error())
+		return
+	}
+
+	_, network, err := net.ParseCIDR(strings.TrimSpace(payload.Subnet))
+	if err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid subnet: "+err.Error())
+		return
+	}
+
+	subnet := models.BlockedSubnet{
+		Subnet: network.String(),
+		Reason: payload.Reason,
+	}
+
+	tx := ac.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "subnet"}},
+		DoUpdates: clause.AssignmentColumns([]string{"reason", "updated_at"}),
+	}).Create(&subnet)
+	if tx.Error != nil {
+		reason := "failed to block subnet: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		ac.Logger.Error(reason)
+		return
+	}
+
+	ac.Logger.Infof("blocked subnet %s: %s", subnet.Subnet, subnet.Reason)
+	middleware.RespondOK(c, subnet)
+}
+
+func (ac AdminController) UnblockSubnet(c *gin.Context) {
+	subnetId, err := strconv.ParseUint(c.Params.ByName("subnet_id"), 10, 64)
+	if err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid subnet id: "+err.Error())
+		return
+	}
+
+	tx := ac.DB.Delete(&models.BlockedSubnet{}, subnetId)
+	if tx.Error != nil {
+		reason := "failed to unblock subnet: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		ac.Logger.Error(reason)
+		return
+	}
+
+	if tx.RowsAffected == 0 {
+		middleware.RespondErr(c, middleware.APIErrorNotFound, "blocked subnet not found")
+		return
+	}
+
+	middleware.RespondOK(c, nil)
+}
+
+// ImportNetworks upserts the IP networks in the CSV request body, which starts with a header row
+// naming its columns: network, latitude, longitude, country_code, city, asn and as_organization.
+// Only network is required, the other columns are left empty when missing.
+func (ac AdminController) ImportNetworks(c *gin.Context) {
+	reader := csv.NewReader(c.Request.Body)
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid header row: "+err.Error())
+		return
+	}
+
+	columns := make(networkColumns)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	if _, ok := columns["network"]; !ok {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "network column is required")
+		return
+	}
+
+	var imported int64
+	var batch []models.Network
+	positions := make(map[string]int)
+
+	save := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		tx := ac.DB.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "network"}},
+			DoUpdates: clause.AssignmentColumns([]string{"latitude", "longitude", "country_code", "city", "asn", "as_organization"}),
+		}).Create(&batch)
+		if tx.Error != nil {
+			return tx.Error
+		}
+
+		imported += tx.RowsAffected
+		batch = batch[:0]
+		positions = make(map[string]int)
+		return nil
+	}
+
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			middleware.RespondErr(c, middleware.APIErrorInvalidRequest, fmt.Sprintf("invalid row %d: %s", row, err))
+			return
+		}
+
+		network, err := columns.parse(record)
+		if err != nil {
+			middleware.RespondErr(c, middleware.APIErrorInvalidRequest, fmt.Sprintf("invalid row %d: %s", row, err))
+			return
+		}
+
+		// a network may only be upserted once per statement, later rows win
+		if i, ok := positions[network.Network]; ok {
+			batch[i] = network
+			continue
+		}
+
+		positions[network.Network] = len(batch)
+		batch = append(batch, network)
+		if len(batch) == 1000 {
+			err = save()
+			if err != nil {
+				reason := "failed to import networks: " + err.Error()
+				middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+				ac.Logger.Error(reason)
+				return
+			}
+		}
+	}
+
+	err = save()
+	if err != nil {
+		reason := "failed to import networks: " + err.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		ac.Logger.Error(reason)
+		return
+	}
+
+	ac.Logger.Infof("imported %d networks", imported)
+	middleware.RespondOK(c, gin.H{"imported": imported})
+}
+
+// networkColumns maps the lowercase column names of a network CSV to their positions.
+type networkColumns map[string]int
+
+func (columns networkColumns) value(record []string, name string) string {
+	i, ok := columns[name]
+	if !ok || i >= len(record) {
+		return ""
+	}
+
+	return strings.TrimSpace(record[i])
+}
+
+func (columns networkColumns) parse(record []string) (models.Network, error) {
+	value := columns.value
+
+	_, ipNet, err := net.ParseCIDR(value(record, "network"))
+	if err != nil {
+		return models.Network{}, err
+	}
+
+	network := models.Network{Network: ipNet.String()}
+
+	if latitude := value(record, "latitude"); latitude != "" {
+		network.Latitude, err = strconv.ParseFloat(latitude, 64)
+		if err != nil {
+			return network, errors.New("invalid latitude: " + err.Error())
+		}
+	}
+
+	if longitude := value(record, "longitude"); longitude != "" {
+		network.Longitude, err = strconv.ParseFloat(longitude, 64)
+		if err != nil {
+			return network, errors.New("invalid longitude: " + err.Error())
+		}
+	}
+
+	if countryCode := value(record, "country_code"); countryCode != "" {
+		countryCode = strings.ToUpper(countryCode)
+		network.CountryCode = &countryCode
+	}
+
+	if city := value(record, "city"); city != "" {
+		network.City = &city
+	}
+
+	if asn := strings.TrimPrefix(strings.ToUpper(value(record, "asn")), "AS"); asn != "" {
+		number, err := strconv.ParseInt(asn, 10, 64)
+		if err != nil {
+			return network, errors.New("invalid asn: " + err.Error())
+		}
+
+		network.ASN = &number
+	}
+
+	if organization := value(record, "as_organization"); organization != "" {
+		network.ASOrganization = &organization
+	}
+
+	return network, nil
+}
+
+func (ac AdminController) GetCityTranslations(c *gin.Context) {
+	city, ok := ac.findCity(c)
+	if !ok {
+		return
+	}
+
+	var translations []models.CityTranslation
+	tx := ac.DB.Where("city_id = ?", city.ID).Order("language").Find(&translations)
+	if tx.Error != nil {
+		reason := "failed to get city translations: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		ac.Logger.Error(reason)
+		return
+	}
+
+	middleware.RespondOK(c, translations)
+}
+
+// SetCityTranslations replaces the translated names of a city with the given names by language.
+// Cities have no CLDR names to seed from, so languages left out fall back to the English name.
+func (ac AdminController) SetCityTranslations(c *gin.Context) {
+	type requestPayload struct {
+		Translations map[string]string `json:"translations"`
+	}
+
+	city, ok := ac.findCity(c)
+	if !ok {
+		return
+	}
+
+	var payload requestPayload
+	if err := c.BindJSON(&payload); err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid request payload: "+err.Error())
+		return
+	}
+
+	supported := make(map[string]bool)
+	for _, tag := range ac.Languages {
+		if tag != language.English {
+			supported[tag.String()] = true
+		}
+	}
+
+	translations := []models.CityTranslation{}
+	for value, name := range payload.Translations {
+		tag, err := language.Parse(strings.TrimSpace(value))
+		if err != nil || !supported[tag.String()] {
+			middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "unsupported language "+value)
+			return
+		}
+
+		name = strings.TrimSpace(name)
+		if name == "" {
+			middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "empty name for language "+value)
+			return
+		}
+
+		translations = append(translations, models.CityTranslation{
+			CityID:   city.ID,
+			Language: tag.String(),
+			Name:     name,
+		})
+	}
+
+	err := ac.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("city_id = ?", city.ID).Delete(&models.CityTranslation{}).Error
+		if err != nil {
+			return err
+		}
+
+		if len(translations) == 0 {
+			return nil
+		}
+
+		return tx.Create(&translations).Error
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "duplicate translation language")
+			return
+		}
+
+		reason := "failed to save city translations: " + err.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		ac.Logger.Error(reason)
+		return
+	}
+
+	ac.Logger.Infof("set %d translations of city %d (%s)", len(translations), city.ID, city.Name)
+	middleware.RespondOK(c, translations)
+}
+
+func (ac AdminController) findCity(c *gin.Context) (*models.City, bool) {
+	cityId, err := strconv.ParseUint(c.Params.ByName("city_id"), 10, 64)
+	if err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid city id: "+err.Error())
+		return nil, false
+	}
+
+	var city models.City
+	tx := ac.DB.First(&city, cityId)
+	if tx.Error != nil {
+		if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			middleware.RespondErr(c, middleware.APIErrorNotFound, "city not found")
+			return nil, false
+		}
+
+		reason := "failed to get city: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		ac.Logger.Error(reason)
+		return nil, false
+	}
+
+	return &city, true
+}
+
+func (ac AdminController) GetRegistrationRejections(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 1000 {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid limit")
+		return
+	}
+
+	query := ac.DB.Order("id desc").Limit(limit)
+	if reason := c.Query("reason"); reason != "" {
+		query = query.Where("reason = ?", reason)
+	}
+
+	var rejections []models.RegistrationRejection
+	tx := query.Find(&rejections)
+	if tx.Error != nil {
+		reason := "failed to get registration rejections: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		ac.Logger.Error(reason)
+		return
+	}
+
+	middleware.RespondOK(c, rejections)
+}
+
+// GetRegistrationAnomalies reports subnets whose registration attempts, accepted or rejected,
+// reached the threshold within a single bucket of the given size.
+func (ac AdminController) GetRegistrationAnomalies(c *gin.Context) {
+	type anomaly struct {
+		Subnet        string    `json:"subnet"`
+		BucketStart   time.Time `json:"bucket_start"`
+		Registrations int64     `json:"registrations"`
+		Rejections    int64     `json:"rejections"`
+	}
+
+	bucket, err := time.ParseDuration(c.DefaultQuery("bucket", "1h"))
+	if err != nil || bucket < time.Minute {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid bucket")
+		return
+	}
+
+	period, err := time.ParseDuration(c.DefaultQuery("period", "24h"))
+	if err != nil || period < bucket || period > 30*24*time.Hour {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid period")
+		return
+	}
+
+	threshold, err := strconv.ParseInt(c.DefaultQuery("threshold", "10"), 10, 64)
+	if err != nil || threshold < 1 {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid threshold")
+		return
+	}
+
+	since := time.Now().Add(-period)
+	seconds := int64(bucket.Seconds())
+
+	anomalies := []anomaly{}
+	tx := ac.DB.Raw(`WITH attempts AS (
+		SELECT registration_subnet AS subnet, created_at, 1 AS registered, 0 AS rejected FROM wallets WHERE registration_subnet IS NOT NULL AND created_at > @since
+		UNION ALL
+		SELECT subnet, created_at, 0, 1 FROM registration_rejections WHERE subnet IS NOT NULL AND created_at > @since
+	)
+	SELECT subnet::text AS subnet, to_timestamp(floor(extract(epoch FROM created_at) / @seconds) * @seconds) AS bucket_start, SUM(registered) AS registrations, SUM(rejected) AS rejections
+	FROM attempts
+	GROUP BY 1, 2
+	HAVING COUNT(*) >= @threshold
+	ORDER BY bucket_start DESC, COUNT(*) DESC`, map[string]interface{}{
+		"since":     since,
+		"seconds":   seconds,
+		"threshold": threshold,
+	}).Scan(&anomalies)
+	if tx.Error != nil {
+		reason := "failed to get registration anomalies: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		ac.Logger.Error(reason)
+		return
+	}
+
+	middleware.RespondOK(c, anomalies)
+}
+
+func (ac AdminController) DeregisterWallet(c *gin.Context) {
+	type requestPayload struct {
+		Reason string `json:"reason"`
+		Erase  bool   `json:"erase"`
+	}
+
+	var payload requestPayload
+	if err := c.BindJSON(&payload); err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid request payload: "+err.Error())
+		return
+	}
+
+	if strings.TrimSpace(payload.Reason) == "" {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "reason is required")
+		return
+	}
+
+	walletAddress, err := ac.Addresses.NormalizeAccount(c.Params.ByName("address"))
+	if err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid wallet address: "+err.Error())
+		return
+	}
+
+	var wallet models.Wallet
+	tx := ac.DB.First(&wallet, "address = ?", walletAddress)
+	if tx.Error != nil {
+		if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			middleware.RespondErr(c, middleware.APIErrorNotFound, "wallet not registered")
+			return
+		}
+
+		reason := "failed to get wallet: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		ac.Logger.Error(reason)
+		return
+	}
+
+	revocation, err := deregisterWallet(ac.DB, wallet, models.WalletRevocationSourceAdmin, strings.TrimSpace(payload.Reason), payload.Erase)
+	if err != nil {
+		reason := "failed to deregister wallet: " + err.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		ac.Logger.Error(reason)
+		return
+	}
+
+	ac.Logger.Infof("deregistered wallet %s: %s", wallet.Address, revocation.Reason)
+	middleware.RespondOK(c, revocation)
+}
+
+func (ac AdminController) GetWalletRevocations(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 1000 {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid limit")
+		return
+	}
+
+	query := ac.DB.Order("id desc").Limit(limit)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", strings.ToUpper(status))
+	}
+
+	var revocations []models.WalletRevocation
+	tx := query.Find(&revocations)
+	if tx.Error != nil {
+		reason := "failed to get wallet revocations: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		ac.Logger.Error(reason)
+		return
+	}
+
+	middleware.RespondOK(c, revocations)
+}
+
+func (ac AdminController) GetReferralReport(c *gin.Context) {
+	type referrer struct {
+		Address   string `json:"address"`
+		Referrals int64  `json:"referrals"`
+		Pending   int64  `json:"pending"`
+		Rewarded  int64  `json:"rewarded"`
+		Rejected  int64  `json:"rejected"`
+	}
+
+	type rejection struct {
+		Reason string `json:"reason"`
+		Count  int64  `json:"count"`
+	}
+
+	type rewards struct {
+		Paid    int64 `json:"paid"`
+		Pending int64 `json:"pending"`
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 1000 {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid limit")
+		return
+	}
+
+	referrers := []referrer{}
+	tx := ac.DB.Raw("SELECT w.address, COUNT(*) AS referrals, COUNT(*) FILTER (WHERE r.status = ?) AS pending, COUNT(*) FILTER (WHERE r.status = ?) AS rewarded, COUNT(*) FILTER (WHERE r.status = ?) AS rejected FROM referrals AS r INNER JOIN wallets AS w ON w.id = r.referrer_id GROUP BY w.address ORDER BY referrals DESC LIMIT ?", models.ReferralStatusPending, models.ReferralStatusRewarded, models.ReferralStatusRejected, limit).Scan(&referrers)
+	if tx.Error != nil {
+		reason := "failed to get top referrers: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		ac.Logger.Error(reason)
+		return
+	}
+
+	rejections := []rejection{}
+	tx = ac.DB.Raw("SELECT rejection_reason AS reason, COUNT(*) AS count FROM referrals WHERE status = ? GROUP BY rejection_reason ORDER BY count DESC", models.ReferralStatusRejected).Scan(&rejections)
+	if tx.Error != nil {
+		reason := "failed to get referral rejections: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		ac.Logger.Error(reason)
+		return
+	}
+
+	var amounts rewards
+	tx = ac.DB.Raw("SELECT COALESCE(SUM(amount) FILTER (WHERE is_redeemed), 0) AS paid, COALESCE(SUM(amount) FILTER (WHERE NOT is_redeemed), 0) AS pending FROM purchases WHERE source = ?", models.PurchaseSourceReferral).Scan(&amounts)
+	if tx.Error != nil {
+		reason := "failed to sum referral rewards: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		ac.Logger.Error(reason)
+		return
+	}
+
+	middleware.RespondOK(c, gin.H{
+		"referrers":  referrers,
+		"rejections": rejections,
+		"rewards":    amounts,
+	})
+}
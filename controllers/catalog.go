@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"dvpn/internal/snapshot"
+	"dvpn/middleware"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type CatalogController struct {
+	Logger   *zap.SugaredLogger
+	Exporter *snapshot.Exporter
+}
+
+func (cc CatalogController) GetLatest(c *gin.Context) {
+	if cc.Exporter == nil {
+		middleware.RespondErr(c, middleware.APIErrorNotFound, "catalog snapshots are not configured")
+		return
+	}
+
+	manifest, data, decompressed, err := cc.Exporter.Latest()
+	if err != nil {
+		if errors.Is(err, snapshot.ErrNotFound) {
+			middleware.RespondErr(c, middleware.APIErrorNotFound, "no catalog snapshot available yet")
+			return
+		}
+
+		reason := "failed to get latest catalog snapshot: " + err.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		cc.Logger.Error(reason)
+		return
+	}
+
+	etag := `"` + manifest.SHA256 + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "public, max-age=300")
+	c.Header("Vary", "Accept-Encoding")
+	c.Header("X-Catalog-Revision", strconv.FormatInt(manifest.Revision, 10))
+	c.Header("X-Catalog-SHA256", manifest.SHA256)
+	c.Header("X-Catalog-Signature", manifest.Signature)
+
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	if strings.Contains(c.GetHeader("Accept-Encoding"), manifest.Encoding) {
+		c.Header("Content-Encoding", manifest.Encoding)
+		c.Data(http.StatusOK, "application/json", data)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json", decompressed)
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"dvpn/models"
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+// deregisterWallet stops all fee grant handling for the wallet and queues the on-chain revocation
+// of its allowance. Deregistering an already deregistered wallet returns the existing revocation,
+// erasing its data if requested.
+func deregisterWallet(db *gorm.DB, wallet models.Wallet, source string, reason string, erase bool) (*models.WalletRevocation, error) {
+	var revocation models.WalletRevocation
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("wallet_id = ?", wallet.ID).First(&revocation).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			revocation = models.WalletRevocation{
+				WalletID: wallet.ID,
+				Address:  wallet.Address,
+				Source:   source,
+				Reason:   reason,
+				Status:   models.WalletRevocationStatusPending,
+			}
+
+			err = tx.Create(&revocation).Error
+			if err != nil {
+				return err
+			}
+
+			// Allocated plan bytes are released by SubscribeWallets.
+			err = tx.Model(&models.Wallet{}).Where("id = ?", wallet.ID).Updates(map[string]interface{}{
+				"deregistered_at": time.Now(),
+				"plan_subscription_status": gorm.Expr(
+					"CASE WHEN plan_subscription_status = ? THEN ? ELSE plan_subscription_status END",
+					models.PlanSubscriptionStatusAllocated, models.PlanSubscriptionStatusReleasing,
+				),
+				"plan_allocation_attempts": 0,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if erase && !revocation.IsErased {
+			err = eraseWalletData(tx, wallet)
+			if err != nil {
+				return err
+			}
+
+			revocation.IsErased = true
+			return tx.Model(&revocation).Update("is_erased", true).Error
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &revocation, nil
+}
+
+// eraseWalletData removes personal data tied to the wallet. The wallet row, purchases, the hashed
+// network of its trial grant and the revocation itself are kept as accounting records.
+func eraseWalletData(tx *gorm.DB, wallet models.Wallet) error {
+	err := tx.Where("wallet_id = ?", wallet.ID).Delete(&models.WalletFavorite{}).Error
+	if err != nil {
+		return err
+	}
+
+	err = tx.Where("wallet_id = ?", wallet.ID).Delete(&models.WalletRecent{}).Error
+	if err != nil {
+		return err
+	}
+
+	err = tx.Where("wallet_id = ?", wallet.ID).Delete(&models.WalletPreferences{}).Error
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(&models.RegistrationRejection{}).Where("address = ?", wallet.Address).Updates(map[string]interface{}{
+		"client_ip": nil,
+		"subnet":    nil,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(&models.Wallet{}).Where("id = ?", wallet.ID).Updates(map[string]interface{}{
+		"last_seen_at":        nil,
+		"registration_ip":     nil,
+		"registration_subnet": nil,
+	}).Error
+}
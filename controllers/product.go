@@ -0,0 +1,287 @@
+package controllers
+
+import (
+	"dvpn/internal/products"
+	"dvpn/middleware"
+	"dvpn/models"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errProductNotFound = errors.New("product not found")
+
+type ProductController struct {
+	DB           *gorm.DB
+	Logger       *zap.SugaredLogger
+	Catalog      *products.Catalog
+	DefaultDenom string
+}
+
+type productOverridePayload struct {
+	Store          string  `json:"store"`
+	StoreProductId *string `json:"store_product_id"`
+	Amount         *int64  `json:"amount"`
+	Denom          *string `json:"denom"`
+}
+
+type productPayload struct {
+	StoreProductId string                   `json:"store_product_id"`
+	Name           string                   `json:"name"`
+	Amount         int64                    `json:"amount"`
+	Denom          string                   `json:"denom"`
+	IsSubscription bool                     `json:"is_subscription"`
+	ActiveFrom     *time.Time               `json:"active_from"`
+	ActiveUntil    *time.Time               `json:"active_until"`
+	Overrides      []productOverridePayload `json:"overrides"`
+}
+
+func (pc ProductController) GetProducts(c *gin.Context) {
+	store := strings.ToUpper(strings.TrimSpace(c.Query("store")))
+
+	entries, err := pc.Catalog.Active(store, time.Now())
+	if err != nil {
+		reason := "failed to get products: " + err.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		pc.Logger.Error(reason)
+		return
+	}
+
+	middleware.RespondOK(c, entries)
+}
+
+func (pc ProductController) GetAdminProducts(c *gin.Context) {
+	var productList []models.Product
+	tx := pc.DB.Preload("Overrides").Order("id").Find(&productList)
+	if tx.Error != nil {
+		reason := "failed to get products: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		pc.Logger.Error(reason)
+		return
+	}
+
+	middleware.RespondOK(c, productList)
+}
+
+func (pc ProductController) CreateProduct(c *gin.Context) {
+	product, ok := pc.bindProduct(c)
+	if !ok {
+		return
+	}
+
+	tx := pc.DB.Create(&product)
+	if tx.Error != nil {
+		pc.respondSaveErr(c, tx.Error)
+		return
+	}
+
+	pc.Catalog.Invalidate()
+
+	pc.Logger.Infof("created product %d (%s)", product.ID, product.StoreProductId)
+	middleware.RespondOK(c, product)
+}
+
+func (pc ProductController) UpdateProduct(c *gin.Context) {
+	productId, err := strconv.ParseUint(c.Params.ByName("product_id"), 10, 64)
+	if err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid product id: "+err.Error())
+		return
+	}
+
+	product, ok := pc.bindProduct(c)
+	if !ok {
+		return
+	}
+
+	product.ID = uint(productId)
+
+	err = pc.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Product{}).Where("id = ?", product.ID).Updates(map[string]interface{}{
+			"store_product_id": product.StoreProductId,
+			"name":             product.Name,
+			"amount":           product.Amount,
+			"denom":            product.Denom,
+			"is_subscription":  product.IsSubscription,
+			"active_from":      product.ActiveFrom,
+			"active_until":     product.ActiveUntil,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return errProductNotFound
+		}
+
+		err := tx.Where("product_id = ?", product.ID).Delete(&models.ProductOverride{}).Error
+		if err != nil {
+			return err
+		}
+
+		for i := range product.Overrides {
+			product.Overrides[i].ProductID = product.ID
+		}
+
+		if len(product.Overrides) > 0 {
+			err = tx.Create(&product.Overrides).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Preload("Overrides").First(&product, product.ID).Error
+	})
+	if err != nil {
+		if errors.Is(err, errProductNotFound) {
+			middleware.RespondErr(c, middleware.APIErrorNotFound, err.Error())
+			return
+		}
+
+		pc.respondSaveErr(c, err)
+		return
+	}
+
+	pc.Catalog.Invalidate()
+
+	pc.Logger.Infof("updated product %d (%s)", product.ID, product.StoreProductId)
+	middleware.RespondOK(c, product)
+}
+
+// RetireProduct ends the active window of a product now. Products are never deleted, so late
+// webhooks for purchases of retired products are still paid out.
+func (pc ProductController) RetireProduct(c *gin.Context) {
+	productId, err := strconv.ParseUint(c.Params.ByName("product_id"), 10, 64)
+	if err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid product id: "+err.Error())
+		return
+	}
+
+	var product models.Product
+	tx := pc.DB.Preload("Overrides").First(&product, productId)
+	if tx.Error != nil {
+		if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			middleware.RespondErr(c, middleware.APIErrorNotFound, errProductNotFound.Error())
+			return
+		}
+
+		reason := "failed to get product: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		pc.Logger.Error(reason)
+		return
+	}
+
+	now := time.Now()
+	if product.ActiveUntil == nil || product.ActiveUntil.After(now) {
+		product.ActiveUntil = &now
+
+		tx = pc.DB.Model(&models.Product{}).Where("id = ?", product.ID).Update("active_until", now)
+		if tx.Error != nil {
+			reason := "failed to retire product: " + tx.Error.Error()
+			middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+			pc.Logger.Error(reason)
+			return
+		}
+
+		pc.Catalog.Invalidate()
+	}
+
+	pc.Logger.Infof("retired product %d (%s)", product.ID, product.StoreProductId)
+	middleware.RespondOK(c, product)
+}
+
+// bindProduct parses and validates the product in the request body, responding with an error
+// when it is invalid.
+func (pc ProductController) bindProduct(c *gin.Context) (models.Product, bool) {
+	var payload productPayload
+	if err := c.BindJSON(&payload); err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid request payload: "+err.Error())
+		return models.Product{}, false
+	}
+
+	product := models.Product{
+		StoreProductId: strings.TrimSpace(payload.StoreProductId),
+		Name:           strings.TrimSpace(payload.Name),
+		Amount:         payload.Amount,
+		Denom:          payload.Denom,
+		IsSubscription: payload.IsSubscription,
+		ActiveFrom:     payload.ActiveFrom,
+		ActiveUntil:    payload.ActiveUntil,
+		Overrides:      []models.ProductOverride{},
+	}
+
+	if product.StoreProductId == "" {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "store_product_id is required")
+		return product, false
+	}
+
+	if product.Name == "" {
+		product.Name = product.StoreProductId
+	}
+
+	if product.Amount <= 0 {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "amount must be positive")
+		return product, false
+	}
+
+	if product.Denom == "" {
+		product.Denom = pc.DefaultDenom
+	}
+
+	if product.ActiveFrom != nil && product.ActiveUntil != nil && !product.ActiveUntil.After(*product.ActiveFrom) {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "active_until must be after active_from")
+		return product, false
+	}
+
+	stores := make(map[string]bool)
+	for _, override := range payload.Overrides {
+		store := strings.ToUpper(strings.TrimSpace(override.Store))
+		if store == "" {
+			middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "override store is required")
+			return product, false
+		}
+
+		if stores[store] {
+			middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "duplicate override for store "+store)
+			return product, false
+		}
+
+		stores[store] = true
+
+		if override.StoreProductId != nil {
+			override.StoreProductId = optionalString(strings.TrimSpace(*override.StoreProductId))
+		}
+
+		if override.Amount != nil && *override.Amount <= 0 {
+			middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "override amount must be positive")
+			return product, false
+		}
+
+		if override.Denom != nil {
+			override.Denom = optionalString(*override.Denom)
+		}
+
+		product.Overrides = append(product.Overrides, models.ProductOverride{
+			Store:          store,
+			StoreProductId: override.StoreProductId,
+			Amount:         override.Amount,
+			Denom:          override.Denom,
+		})
+	}
+
+	return product, true
+}
+
+func (pc ProductController) respondSaveErr(c *gin.Context, err error) {
+	if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "store product id already exists")
+		return
+	}
+
+	reason := "failed to save product: " + err.Error()
+	middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+	pc.Logger.Error(reason)
+}
@@ -0,0 +1,441 @@
+package controllers
+
+import (
+	"dvpn/internal/address"
+	"dvpn/internal/protocols"
+	"dvpn/middleware"
+	"dvpn/models"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+const (
+	maxWalletFavorites = 100
+	maxWalletRecents   = 20
+)
+
+type ProfileController struct {
+	DB        *gorm.DB
+	Logger    *zap.SugaredLogger
+	Protocols *protocols.Registry
+	Addresses address.Prefixes
+}
+
+type profileServer struct {
+	ServerAddress string         `json:"server_address"`
+	IsAvailable   bool           `json:"is_available"`
+	Server        *models.Server `json:"server"`
+	CreatedAt     *time.Time     `json:"created_at,omitempty"`
+	ConnectedAt   *time.Time     `json:"connected_at,omitempty"`
+}
+
+func (pc ProfileController) GetFavorites(c *gin.Context) {
+	wallet, ok := pc.findWallet(c)
+	if !ok {
+		return
+	}
+
+	pc.respondFavorites(c, wallet)
+}
+
+func (pc ProfileController) SetFavorites(c *gin.Context) {
+	type requestPayload struct {
+		Addresses []string `json:"addresses"`
+	}
+
+	wallet, ok := pc.findWallet(c)
+	if !ok {
+		return
+	}
+
+	var payload requestPayload
+	if err := c.BindJSON(&payload); err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid request payload: "+err.Error())
+		return
+	}
+
+	addresses, err := pc.normalizeServerAddresses(payload.Addresses)
+	if err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, err.Error())
+		return
+	}
+
+	if len(addresses) > maxWalletFavorites {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "too many favorites")
+		return
+	}
+
+	err = pc.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("wallet_id = ? AND server_address NOT IN ?", wallet.ID, append(addresses, "")).Delete(&models.WalletFavorite{}).Error
+		if err != nil {
+			return err
+		}
+
+		if len(addresses) == 0 {
+			return nil
+		}
+
+		var favorites []models.WalletFavorite
+		for _, address := range addresses {
+			favorites = append(favorites, models.WalletFavorite{WalletID: wallet.ID, ServerAddress: address})
+		}
+
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&favorites).Error
+	})
+	if err != nil {
+		reason := "failed to save favorites: " + err.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		pc.Logger.Error(reason)
+		return
+	}
+
+	pc.respondFavorites(c, wallet)
+}
+
+func (pc ProfileController) AddFavorite(c *gin.Context) {
+	wallet, ok := pc.findWallet(c)
+	if !ok {
+		return
+	}
+
+	addresses, err := pc.normalizeServerAddresses([]string{c.Params.ByName("server_address")})
+	if err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, err.Error())
+		return
+	}
+
+	var count int64
+	tx := pc.DB.Model(&models.WalletFavorite{}).Where("wallet_id = ?", wallet.ID).Count(&count)
+	if tx.Error != nil {
+		reason := "failed to count favorites: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		pc.Logger.Error(reason)
+		return
+	}
+
+	if count >= maxWalletFavorites {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "too many favorites")
+		return
+	}
+
+	favorite := models.WalletFavorite{
+		WalletID:      wallet.ID,
+		ServerAddress: addresses[0],
+	}
+
+	tx = pc.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&favorite)
+	if tx.Error != nil {
+		reason := "failed to create favorite: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		pc.Logger.Error(reason)
+		return
+	}
+
+	pc.respondFavorites(c, wallet)
+}
+
+func (pc ProfileController) RemoveFavorite(c *gin.Context) {
+	wallet, ok := pc.findWallet(c)
+	if !ok {
+		return
+	}
+
+	serverAddress, err := pc.Addresses.NormalizeNode(c.Params.ByName("server_address"))
+	if err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid server address: "+err.Error())
+		return
+	}
+
+	tx := pc.DB.Where("wallet_id = ? AND server_address = ?", wallet.ID, serverAddress).Delete(&models.WalletFavorite{})
+	if tx.Error != nil {
+		reason := "failed to delete favorite: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		pc.Logger.Error(reason)
+		return
+	}
+
+	pc.respondFavorites(c, wallet)
+}
+
+func (pc ProfileController) GetRecents(c *gin.Context) {
+	wallet, ok := pc.findWallet(c)
+	if !ok {
+		return
+	}
+
+	pc.respondRecents(c, wallet)
+}
+
+func (pc ProfileController) AddRecent(c *gin.Context) {
+	type requestPayload struct {
+		ServerAddress string `json:"server_address"`
+	}
+
+	wallet, ok := pc.findWallet(c)
+	if !ok {
+		return
+	}
+
+	var payload requestPayload
+	if err := c.BindJSON(&payload); err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid request payload: "+err.Error())
+		return
+	}
+
+	addresses, err := pc.normalizeServerAddresses([]string{payload.ServerAddress})
+	if err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, err.Error())
+		return
+	}
+
+	recent := models.WalletRecent{
+		WalletID:      wallet.ID,
+		ServerAddress: addresses[0],
+		ConnectedAt:   time.Now(),
+	}
+
+	err = pc.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "wallet_id"}, {Name: "server_address"}},
+			DoUpdates: clause.AssignmentColumns([]string{"connected_at", "updated_at"}),
+		}).Create(&recent).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Exec("DELETE FROM wallet_recents WHERE wallet_id = ? AND id NOT IN (SELECT id FROM wallet_recents WHERE wallet_id = ? ORDER BY connected_at DESC LIMIT ?)", wallet.ID, wallet.ID, maxWalletRecents).Error
+	})
+	if err != nil {
+		reason := "failed to save recent server: " + err.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		pc.Logger.Error(reason)
+		return
+	}
+
+	pc.respondRecents(c, wallet)
+}
+
+func (pc ProfileController) GetPreferences(c *gin.Context) {
+	wallet, ok := pc.findWallet(c)
+	if !ok {
+		return
+	}
+
+	var preferences models.WalletPreferences
+	tx := pc.DB.Where("wallet_id = ?", wallet.ID).Limit(1).Find(&preferences)
+	if tx.Error != nil {
+		reason := "failed to get preferences: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		pc.Logger.Error(reason)
+		return
+	}
+
+	middleware.RespondOK(c, preferences)
+}
+
+func (pc ProfileController) SetPreferences(c *gin.Context) {
+	type requestPayload struct {
+		PreferredProtocol *models.ServerProtocol `json:"preferred_protocol"`
+		DefaultCountryID  *uint                  `json:"default_country_id"`
+	}
+
+	wallet, ok := pc.findWallet(c)
+	if !ok {
+		return
+	}
+
+	var payload requestPayload
+	if err := c.BindJSON(&payload); err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid request payload: "+err.Error())
+		return
+	}
+
+	if payload.PreferredProtocol != nil {
+		protocol, ok := pc.Protocols.ByName(string(*payload.PreferredProtocol))
+		if !ok {
+			middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid protocol")
+			return
+		}
+
+		payload.PreferredProtocol = &protocol.Name
+	}
+
+	if payload.DefaultCountryID != nil {
+		var country models.Country
+		tx := pc.DB.First(&country, *payload.DefaultCountryID)
+		if tx.Error != nil {
+			if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+				middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid country id")
+				return
+			}
+
+			reason := "failed to get country: " + tx.Error.Error()
+			middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+			pc.Logger.Error(reason)
+			return
+		}
+	}
+
+	preferences := models.WalletPreferences{
+		WalletID:          wallet.ID,
+		PreferredProtocol: payload.PreferredProtocol,
+		DefaultCountryID:  payload.DefaultCountryID,
+	}
+
+	tx := pc.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "wallet_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"preferred_protocol", "default_country_id", "updated_at"}),
+	}).Create(&preferences)
+	if tx.Error != nil {
+		reason := "failed to save preferences: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		pc.Logger.Error(reason)
+		return
+	}
+
+	middleware.RespondOK(c, preferences)
+}
+
+func (pc ProfileController) findWallet(c *gin.Context) (*models.Wallet, bool) {
+	var wallet models.Wallet
+	tx := pc.DB.First(&wallet, "address = ? AND deregistered_at IS NULL", c.GetString(middleware.WalletAddressKey))
+	if tx.Error != nil {
+		if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			middleware.RespondErr(c, middleware.APIErrorNotFound, "wallet not registered")
+			return nil, false
+		}
+
+		reason := "failed to get wallet: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		pc.Logger.Error(reason)
+		return nil, false
+	}
+
+	err := touchWallet(pc.DB, wallet.Address)
+	if err != nil {
+		pc.Logger.Warnf("failed to update last seen time of wallet %s: %s", wallet.Address, err)
+	}
+
+	return &wallet, true
+}
+
+func (pc ProfileController) respondFavorites(c *gin.Context, wallet *models.Wallet) {
+	var favorites []models.WalletFavorite
+	tx := pc.DB.Where("wallet_id = ?", wallet.ID).Order("created_at").Find(&favorites)
+	if tx.Error != nil {
+		reason := "failed to get favorites: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		pc.Logger.Error(reason)
+		return
+	}
+
+	var addresses []string
+	for _, favorite := range favorites {
+		addresses = append(addresses, favorite.ServerAddress)
+	}
+
+	servers, err := pc.findServers(addresses)
+	if err != nil {
+		reason := "failed to get servers: " + err.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		pc.Logger.Error(reason)
+		return
+	}
+
+	result := make([]profileServer, 0, len(favorites))
+	for _, favorite := range favorites {
+		createdAt := favorite.CreatedAt
+		item := newProfileServer(favorite.ServerAddress, servers)
+		item.CreatedAt = &createdAt
+		result = append(result, item)
+	}
+
+	middleware.RespondOK(c, result)
+}
+
+func (pc ProfileController) respondRecents(c *gin.Context, wallet *models.Wallet) {
+	var recents []models.WalletRecent
+	tx := pc.DB.Where("wallet_id = ?", wallet.ID).Order("connected_at desc").Limit(maxWalletRecents).Find(&recents)
+	if tx.Error != nil {
+		reason := "failed to get recent servers: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		pc.Logger.Error(reason)
+		return
+	}
+
+	var addresses []string
+	for _, recent := range recents {
+		addresses = append(addresses, recent.ServerAddress)
+	}
+
+	servers, err := pc.findServers(addresses)
+	if err != nil {
+		reason := "failed to get servers: " + err.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		pc.Logger.Error(reason)
+		return
+	}
+
+	result := make([]profileServer, 0, len(recents))
+	for _, recent := range recents {
+		connectedAt := recent.ConnectedAt
+		item := newProfileServer(recent.ServerAddress, servers)
+		item.ConnectedAt = &connectedAt
+		result = append(result, item)
+	}
+
+	middleware.RespondOK(c, result)
+}
+
+func (pc ProfileController) findServers(addresses []string) (map[string]models.Server, error) {
+	servers := make(map[string]models.Server)
+	if len(addresses) == 0 {
+		return servers, nil
+	}
+
+	var found []models.Server
+	tx := pc.DB.Model(&models.Server{}).Where("address IN ?", addresses).Find(&found)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	for _, server := range found {
+		servers[server.Address] = server
+	}
+
+	return servers, nil
+}
+
+func newProfileServer(address string, servers map[string]models.Server) profileServer {
+	item := profileServer{ServerAddress: address}
+
+	if server, ok := servers[address]; ok {
+		item.Server = &server
+		item.IsAvailable = server.IsActive && !server.IsBanned
+	}
+
+	return item
+}
+
+func (pc ProfileController) normalizeServerAddresses(addresses []string) ([]string, error) {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(addresses))
+
+	for _, serverAddress := range addresses {
+		serverAddress, err := pc.Addresses.NormalizeNode(serverAddress)
+		if err != nil {
+			return nil, errors.New("invalid server address: " + err.Error())
+		}
+
+		if !seen[serverAddress] {
+			seen[serverAddress] = true
+			result = append(result, serverAddress)
+		}
+	}
+
+	return result, nil
+}
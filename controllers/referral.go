@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"dvpn/middleware"
+	"dvpn/models"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"math/big"
+	"strings"
+)
+
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+const referralCodeLength = 8
+
+func (wc WalletController) GetReferrals(c *gin.Context) {
+	type responseObject struct {
+		Code     string `json:"code"`
+		Pending  int64  `json:"pending"`
+		Rewarded int64  `json:"rewarded"`
+		Rejected int64  `json:"rejected"`
+		Earned   int64  `json:"earned"`
+	}
+
+	var wallet models.Wallet
+	tx := wc.DB.First(&wallet, "address = ? AND deregistered_at IS NULL", c.GetString(middleware.WalletAddressKey))
+	if tx.Error != nil {
+		if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			middleware.RespondErr(c, middleware.APIErrorNotFound, "wallet not registered")
+			return
+		}
+
+		reason := "failed to get wallet: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		wc.Logger.Error(reason)
+		return
+	}
+
+	code, err := assignReferralCode(wc.DB, wallet)
+	if err != nil {
+		reason := "failed to assign referral code: " + err.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		wc.Logger.Error(reason)
+		return
+	}
+
+	result := responseObject{
+		Code: code,
+	}
+
+	tx = wc.DB.Raw("SELECT COUNT(*) FILTER (WHERE status = ?) AS pending, COUNT(*) FILTER (WHERE status = ?) AS rewarded, COUNT(*) FILTER (WHERE status = ?) AS rejected FROM referrals WHERE referrer_id = ?", models.ReferralStatusPending, models.ReferralStatusRewarded, models.ReferralStatusRejected, wallet.ID).Scan(&result)
+	if tx.Error != nil {
+		reason := "failed to count referrals: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		wc.Logger.Error(reason)
+		return
+	}
+
+	tx = wc.DB.Model(&models.Purchase{}).Select("COALESCE(SUM(amount), 0)").Where("address = ? AND source = ?", wallet.Address, models.PurchaseSourceReferral).Scan(&result.Earned)
+	if tx.Error != nil {
+		reason := "failed to sum referral rewards: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		wc.Logger.Error(reason)
+		return
+	}
+
+	middleware.RespondOK(c, result)
+}
+
+// findReferrer returns the active wallet owning the referral code.
+func (wc WalletController) findReferrer(code string) (*models.Wallet, error) {
+	var referrers []models.Wallet
+	tx := wc.DB.Where("referral_code = ? AND deregistered_at IS NULL", strings.ToUpper(strings.TrimSpace(code))).Limit(1).Find(&referrers)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	if len(referrers) == 0 {
+		return nil, nil
+	}
+
+	return &referrers[0], nil
+}
+
+// assignReferralCode returns the wallet's referral code, generating one if the wallet has none yet.
+func assignReferralCode(db *gorm.DB, wallet models.Wallet) (string, error) {
+	if wallet.ReferralCode != nil {
+		return *wallet.ReferralCode, nil
+	}
+
+	for attempt := 0; attempt < 5; attempt++ {
+		code, err := generateCode(referralCodeLength)
+		if err != nil {
+			return "", err
+		}
+
+		tx := db.Model(&models.Wallet{}).Where("id = ? AND referral_code IS NULL", wallet.ID).Update("referral_code", code)
+		if tx.Error != nil {
+			if strings.Contains(tx.Error.Error(), "duplicate key value violates unique constraint") {
+				continue
+			}
+
+			return "", tx.Error
+		}
+
+		if tx.RowsAffected == 0 {
+			err = db.Model(&models.Wallet{}).Select("referral_code").Where("id = ?", wallet.ID).Scan(&code).Error
+			return code, err
+		}
+
+		return code, nil
+	}
+
+	return "", errors.New("no unique referral code found")
+}
+
+// generateCode returns a random code without characters that are easily confused, such as 0 and O.
+func generateCode(length int) (string, error) {
+	var code strings.Builder
+
+	max := big.NewInt(int64(len(codeAlphabet)))
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+
+		code.WriteByte(codeAlphabet[n.Int64()])
+	}
+
+	return code.String(), nil
+}
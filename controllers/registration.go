@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"dvpn/internal/clientip"
+	"dvpn/internal/pow"
+	"dvpn/middleware"
+	"dvpn/models"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"strconv"
+	"time"
+)
+
+type RegistrationLimits struct {
+	MaxPerIP     int64
+	MaxPerSubnet int64
+	Window       time.Duration
+}
+
+// RegistrationCounter counts the wallets registered after a point in time from an IP address or
+// from a subnet.
+type RegistrationCounter interface {
+	CountByIP(ipAddr string, since time.Time) (int64, error)
+	CountBySubnet(subnet string, since time.Time) (int64, error)
+}
+
+// Check counts the registrations from the IP address and its subnet within the window before now
+// against the caps, skipping caps that are not set. It returns the rejection reason and details
+// of the first exceeded cap, or an empty reason when the registration is allowed.
+func (l RegistrationLimits) Check(counter RegistrationCounter, ipAddr string, subnet string, now time.Time) (string, string, error) {
+	since := now.Add(-l.Window)
+
+	if l.MaxPerIP > 0 {
+		registrations, err := counter.CountByIP(ipAddr, since)
+		if err != nil {
+			return "", "", err
+		}
+
+		if registrations >= l.MaxPerIP {
+			return models.RegistrationRejectionIPLimit, strconv.FormatInt(registrations, 10) + " registrations in " + l.Window.String(), nil
+		}
+	}
+
+	if l.MaxPerSubnet > 0 {
+		registrations, err := counter.CountBySubnet(subnet, since)
+		if err != nil {
+			return "", "", err
+		}
+
+		if registrations >= l.MaxPerSubnet {
+			return models.RegistrationRejectionSubnetLimit, strconv.FormatInt(registrations, 10) + " registrations in " + l.Window.String(), nil
+		}
+	}
+
+	return "", "", nil
+}
+
+type walletRegistrations struct {
+	DB *gorm.DB
+}
+
+func (r walletRegistrations) CountByIP(ipAddr string, since time.Time) (int64, error) {
+	var registrations int64
+	tx := r.DB.Model(&models.Wallet{}).Where("registration_ip = ?::inet AND created_at > ?", ipAddr, since).Count(&registrations)
+	return registrations, tx.Error
+}
+
+func (r walletRegistrations) CountBySubnet(subnet string, since time.Time) (int64, error) {
+	var registrations int64
+	tx := r.DB.Model(&models.Wallet{}).Where("registration_subnet = ?::cidr AND created_at > ?", subnet, since).Count(&registrations)
+	return registrations, tx.Error
+}
+
+func (wc WalletController) GetRegistrationChallenge(c *gin.Context) {
+	if wc.Challenges == nil {
+		middleware.RespondErr(c, middleware.APIErrorNotFound, "proof of work is not required")
+		return
+	}
+
+	challenge, err := wc.Challenges.Issue()
+	if err != nil {
+		reason := "failed to issue challenge: " + err.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		wc.Logger.Error(reason)
+		return
+	}
+
+	middleware.RespondOK(c, challenge)
+}
+
+// checkRegistration applies the subnet blocklist and the proof of work to a new wallet. Rejections
+// are stored and answered, in which case ok is false. The per-IP and per-subnet caps are applied by
+// createWallet, together with the insert.
+func (wc WalletController) checkRegistration(c *gin.Context, walletAddress string, challenge string, nonce string) (ipAddr string, subnet string, ok bool) {
+	ip, err := wc.ClientIPResolver.ClientIP(c.Request)
+	if err != nil {
+		reason := "failed to get IP address: " + err.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		wc.Logger.Error(reason)
+		return "", "", false
+	}
+
+	ipAddr = ip.String()
+	subnet = clientip.Subnet(ip).String()
+
+	rejection := models.RegistrationRejection{
+		Address:  walletAddress,
+		ClientIP: &ipAddr,
+		Subnet:   &subnet,
+	}
+
+	var blockedSubnets []models.BlockedSubnet
+	tx := wc.DB.Where("subnet >>= ?::inet", ipAddr).Limit(1).Find(&blockedSubnets)
+	if tx.Error != nil {
+		reason := "failed to check blocked subnets: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		wc.Logger.Error(reason)
+		return "", "", false
+	}
+
+	if len(blockedSubnets) > 0 {
+		rejection.Reason = models.RegistrationRejectionBlockedSubnet
+		rejection.Details = blockedSubnets[0].Subnet
+		wc.rejectRegistration(c, rejection, middleware.APIErrorInvalidRequest, "registration is not allowed from this network")
+		return "", "", false
+	}
+
+	if wc.Challenges != nil {
+		err = wc.Challenges.Redeem(wc.UsedChallenges, challenge, walletAddress, nonce)
+		if errors.Is(err, pow.ErrReused) {
+			rejection.Reason = models.RegistrationRejectionChallengeReuse
+			wc.rejectRegistration(c, rejection, middleware.APIErrorInvalidRequest, "challenge already used")
+			return "", "", false
+		}
+
+		if pow.IsRejection(err) {
+			rejection.Reason = models.RegistrationRejectionProofOfWork
+			rejection.Details = err.Error()
+			wc.rejectRegistration(c, rejection, middleware.APIErrorInvalidRequest, "invalid proof of work: "+err.Error())
+			return "", "", false
+		}
+
+		if err != nil {
+			reason := "failed to save challenge: " + err.Error()
+			middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+			wc.Logger.Error(reason)
+			return "", "", false
+		}
+	}
+
+	return ipAddr, subnet, true
+}
+
+// createWallet applies the per-IP and per-subnet caps and inserts the wallet in one transaction.
+// Registrations from a subnet hold an advisory lock on it until commit, so concurrent requests
+// cannot all pass the caps before any of them has inserted its wallet. It returns the rejection
+// reason and details of an exceeded cap, in which case nothing is inserted.
+func (wc WalletController) createWallet(wallet *models.Wallet) (string, string, error) {
+	var limitReason, limitDetails string
+	err := wc.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "wallet_registration:"+*wallet.RegistrationSubnet).Error
+		if err != nil {
+			return errors.New("failed to lock subnet: " + err.Error())
+		}
+
+		limitReason, limitDetails, err = wc.Registration.Check(walletRegistrations{DB: tx}, *wallet.RegistrationIP, *wallet.RegistrationSubnet, time.Now())
+		if err != nil {
+			return errors.New("failed to count registrations: " + err.Error())
+		}
+
+		if limitReason != "" {
+			return nil
+		}
+
+		return tx.Create(wallet).Error
+	})
+
+	return limitReason, limitDetails, err
+}
+
+// rejectLimit stores and answers a registration that exceeded a cap of createWallet.
+func (wc WalletController) rejectLimit(c *gin.Context, wallet models.Wallet, limitReason string, limitDetails string) {
+	rejection := models.RegistrationRejection{
+		Address:  wallet.Address,
+		ClientIP: wallet.RegistrationIP,
+		Subnet:   wallet.RegistrationSubnet,
+		Reason:   limitReason,
+		Details:  limitDetails,
+	}
+
+	if limitReason == models.RegistrationRejectionIPLimit {
+		wc.rejectRegistration(c, rejection, middleware.APIErrorRateLimited, "too many registrations from this IP address")
+		return
+	}
+
+	wc.rejectRegistration(c, rejection, middleware.APIErrorRateLimited, "too many registrations from this network")
+}
+
+func (wc WalletController) rejectRegistration(c *gin.Context, rejection models.RegistrationRejection, apiErr middleware.APIError, message string) {
+	tx := wc.DB.Create(&rejection)
+	if tx.Error != nil {
+		wc.Logger.Error("failed to save registration rejection: " + tx.Error.Error())
+	}
+
+	wc.Logger.Infof("rejected registration of wallet %s from %s: %s", rejection.Address, *rejection.ClientIP, rejection.Reason)
+	middleware.RespondErr(c, apiErr, message)
+}
@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"dvpn/internal/clientip"
+	"dvpn/models"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+type registrationAttempt struct {
+	ip     string
+	subnet string
+	at     time.Time
+}
+
+// memoryRegistrations counts registrations the way the wallets table does: strictly after since,
+// by exact IP address or by /24 (IPv4) or /48 (IPv6) subnet.
+type memoryRegistrations struct {
+	attempts []registrationAttempt
+	err      error
+	queries  []string
+	since    []time.Time
+}
+
+func (r *memoryRegistrations) register(ip string, at time.Time) {
+	r.attempts = append(r.attempts, registrationAttempt{ip: ip, subnet: clientip.Subnet(net.ParseIP(ip)).String(), at: at})
+}
+
+func (r *memoryRegistrations) CountByIP(ipAddr string, since time.Time) (int64, error) {
+	r.queries = append(r.queries, "ip")
+	r.since = append(r.since, since)
+
+	var count int64
+	for _, attempt := range r.attempts {
+		if attempt.ip == ipAddr && attempt.at.After(since) {
+			count++
+		}
+	}
+
+	return count, r.err
+}
+
+func (r *memoryRegistrations) CountBySubnet(subnet string, since time.Time) (int64, error) {
+	r.queries = append(r.queries, "subnet")
+	r.since = append(r.since, since)
+
+	var count int64
+	for _, attempt := range r.attempts {
+		if attempt.subnet == subnet && attempt.at.After(since) {
+			count++
+		}
+	}
+
+	return count, r.err
+}
+
+func TestRegistrationLimitsCheck(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	window := 24 * time.Hour
+
+	tests := []struct {
+		name        string
+		limits      RegistrationLimits
+		ip          string
+		previous    []string
+		age         time.Duration
+		wantReason  string
+		wantDetails string
+		wantQueries []string
+	}{
+		{
+			name:        "caps disabled",
+			limits:      RegistrationLimits{Window: window},
+			ip:          "203.0.113.7",
+			previous:    []string{"203.0.113.7", "203.0.113.7", "203.0.113.7"},
+			wantQueries: nil,
+		},
+		{
+			name:        "below ip cap",
+			limits:      RegistrationLimits{MaxPerIP: 2, Window: window},
+			ip:          "203.0.113.7",
+			previous:    []string{"203.0.113.7"},
+			wantQueries: []string{"ip"},
+		},
+		{
+			name:        "at ip cap",
+			limits:      RegistrationLimits{MaxPerIP: 2, MaxPerSubnet: 10, Window: window},
+			ip:          "203.0.113.7",
+			previous:    []string{"203.0.113.7", "203.0.113.7"},
+			wantReason:  models.RegistrationRejectionIPLimit,
+			wantDetails: "2 registrations in 24h0m0s",
+			wantQueries: []string{"ip"},
+		},
+		{
+			name:        "other ips of the subnet do not count for the ip cap",
+			limits:      RegistrationLimits{MaxPerIP: 2, Window: window},
+			ip:          "203.0.113.7",
+			previous:    []string{"203.0.113.8", "203.0.113.9", "203.0.113.7"},
+			wantQueries: []string{"ip"},
+		},
+		{
+			name:        "at ipv4 subnet cap",
+			limits:      RegistrationLimits{MaxPerIP: 2, MaxPerSubnet: 3, Window: window},
+			ip:          "203.0.113.7",
+			previous:    []string{"203.0.113.8", "203.0.113.9", "203.0.113.200"},
+			wantReason:  models.RegistrationRejectionSubnetLimit,
+			wantDetails: "3 registrations in 24h0m0s",
+			wantQueries: []string{"ip", "subnet"},
+		},
+		{
+			name:        "neighbouring ipv4 subnet",
+			limits:      RegistrationLimits{MaxPerSubnet: 1, Window: window},
+			ip:          "203.0.113.7",
+			previous:    []string{"203.0.114.7", "203.0.112.7"},
+			wantQueries: []string{"subnet"},
+		},
+		{
+			name:        "at ipv6 subnet cap",
+			limits:      RegistrationLimits{MaxPerSubnet: 2, Window: window},
+			ip:          "2001:db8:1:2::1",
+			previous:    []string{"2001:db8:1:3::1", "2001:db8:1:ffff::2"},
+			wantReason:  models.RegistrationRejectionSubnetLimit,
+			wantDetails: "2 registrations in 24h0m0s",
+			wantQueries: []string{"subnet"},
+		},
+		{
+			name:        "neighbouring ipv6 subnet",
+			limits:      RegistrationLimits{MaxPerSubnet: 1, Window: window},
+			ip:          "2001:db8:1:2::1",
+			previous:    []string{"2001:db8:2:2::1"},
+			wantQueries: []string{"subnet"},
+		},
+		{
+			name:        "registrations outside the window",
+			limits:      RegistrationLimits{MaxPerIP: 1, MaxPerSubnet: 1, Window: window},
+			ip:          "203.0.113.7",
+			previous:    []string{"203.0.113.7", "203.0.113.8"},
+			age:         window,
+			wantQueries: []string{"ip", "subnet"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			registrations := &memoryRegistrations{}
+			for _, ip := range test.previous {
+				registrations.register(ip, now.Add(-test.age))
+			}
+
+			subnet := clientip.Subnet(net.ParseIP(test.ip)).String()
+
+			reason, details, err := test.limits.Check(registrations, test.ip, subnet, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if reason != test.wantReason || details != test.wantDetails {
+				t.Errorf("Check() = %q, %q, want %q, %q", reason, details, test.wantReason, test.wantDetails)
+			}
+
+			if len(registrations.queries) != len(test.wantQueries) {
+				t.Fatalf("Check() counted %v, want %v", registrations.queries, test.wantQueries)
+			}
+
+			for i, query := range registrations.queries {
+				if query != test.wantQueries[i] {
+					t.Errorf("Check() counted %v, want %v", registrations.queries, test.wantQueries)
+				}
+
+				if !registrations.since[i].Equal(now.Add(-window)) {
+					t.Errorf("Check() counted %s since %s, want %s", query, registrations.since[i], now.Add(-window))
+				}
+			}
+		})
+	}
+}
+
+func TestRegistrationLimitsCheckError(t *testing.T) {
+	limits := RegistrationLimits{MaxPerIP: 1, MaxPerSubnet: 1, Window: time.Hour}
+	registrations := &memoryRegistrations{err: errors.New("connection refused")}
+
+	reason, _, err := limits.Check(registrations, "203.0.113.7", "203.0.113.0/24", time.Now())
+	if err == nil || reason != "" {
+		t.Fatalf("Check() = %q, %v, want a counting error", reason, err)
+	}
+}
@@ -0,0 +1,449 @@
+package controllers
+
+import (
+	"dvpn/internal/feegrant"
+	"dvpn/internal/revenuecat"
+	"dvpn/middleware"
+	"dvpn/models"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"os"
+	"strings"
+	"time"
+)
+
+// RevenueCat reports refunds issued by the store as cancellations with this reason.
+const revenueCatCancelReasonRefund = "CUSTOMER_SUPPORT"
+
+var (
+	errRevenueCatWalletNotFound     = errors.New("no valid wallet address among app user ids")
+	errRevenueCatUnknownProduct     = errors.New("invalid product id")
+	errRevenueCatNotSubscription    = errors.New("product is not a subscription")
+	errRevenueCatMissingTransaction = errors.New("missing transaction id")
+)
+
+func (wc WalletController) HandleRevenueCatWebhook(c *gin.Context) {
+
+	auth := c.GetHeader("Authorization")
+	if auth != os.Getenv("REVENUECAT_AUTH") {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid authorization header")
+		return
+	}
+
+	var payload revenuecat.Payload
+	if err := c.BindJSON(&payload); err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid request payload: "+err.Error())
+		return
+	}
+
+	event := payload.Event
+	if event.Id == "" {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid event id")
+		return
+	}
+
+	var count int64
+	tx := wc.DB.Model(&models.RevenueCatEvent{}).Where("event_id = ?", event.Id).Count(&count)
+	if tx.Error != nil {
+		reason := "failed to get RevenueCat event: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		wc.Logger.Error(reason)
+		return
+	}
+
+	if count > 0 {
+		middleware.RespondOK(c, nil)
+		return
+	}
+
+	record := models.RevenueCatEvent{
+		EventId:               event.Id,
+		Type:                  event.Type,
+		Environment:           event.Environment,
+		Store:                 event.Store,
+		AppUserId:             event.AppUserId,
+		ProductId:             event.ProductId,
+		TransactionId:         event.TransactionId,
+		OriginalTransactionId: event.OriginalTransactionId,
+		Outcome:               models.RevenueCatOutcomeIgnored,
+	}
+
+	err := wc.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+
+		switch event.Type {
+		case revenuecat.EventTypeInitialPurchase, revenuecat.EventTypeNonRenewingPurchase, revenuecat.EventTypeRenewal:
+			err = wc.queueRevenueCatPurchase(tx, event, &record)
+		case revenuecat.EventTypeCancellation, revenuecat.EventTypeRefund:
+			record.Outcome = models.RevenueCatOutcomeUnmatched
+			err = wc.recordRevenueCatCancellation(tx, event, &record)
+			if err == nil {
+				err = wc.recordRevenueCatSubscriptionChange(tx, event, &record)
+			}
+		case revenuecat.EventTypeUncancellation, revenuecat.EventTypeBillingIssue, revenuecat.EventTypeExpiration:
+			record.Outcome = models.RevenueCatOutcomeUnmatched
+			err = wc.recordRevenueCatSubscriptionChange(tx, event, &record)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&record).Error
+	})
+	if err != nil {
+		if errors.Is(err, errRevenueCatWalletNotFound) || errors.Is(err, errRevenueCatUnknownProduct) ||
+			errors.Is(err, errRevenueCatNotSubscription) || errors.Is(err, errRevenueCatMissingTransaction) {
+			middleware.RespondErr(c, middleware.APIErrorInvalidRequest, err.Error())
+			return
+		}
+
+		reason := "failed to process RevenueCat event " + event.Id + ": " + err.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		wc.Logger.Error(reason)
+		return
+	}
+
+	middleware.RespondOK(c, nil)
+}
+
+func (wc WalletController) queueRevenueCatPurchase(tx *gorm.DB, event revenuecat.Event, record *models.RevenueCatEvent) error {
+	// Sandbox purchases are made by testers with store test accounts and are not paid in real tokens.
+	if event.Environment == revenuecat.EnvironmentSandbox {
+		return nil
+	}
+
+	walletAddress := wc.findRevenueCatWallet(event)
+	if walletAddress == "" {
+		return errRevenueCatWalletNotFound
+	}
+
+	product, err := wc.Products.Resolve(event.Store, event.ProductId)
+	if err != nil {
+		return errors.New("failed to get product: " + err.Error())
+	}
+
+	if product == nil {
+		return errRevenueCatUnknownProduct
+	}
+
+	if event.Type == revenuecat.EventTypeRenewal && !product.IsSubscription {
+		return errRevenueCatNotSubscription
+	}
+
+	purchase := models.Purchase{
+		EventId:               event.Id,
+		Address:               walletAddress,
+		Amount:                product.Amount,
+		Denom:                 product.Denom,
+		Source:                models.PurchaseSourcePurchase,
+		EventType:             optionalString(event.Type),
+		Store:                 optionalString(event.Store),
+		Environment:           optionalString(event.Environment),
+		ProductId:             optionalString(event.ProductId),
+		TransactionId:         optionalString(event.TransactionId),
+		OriginalTransactionId: optionalString(event.OriginalTransactionId),
+		Price:                 event.Price,
+		Currency:              optionalString(event.Currency),
+	}
+
+	if product.IsSubscription {
+		subscription, err := wc.renewStoreSubscription(tx, event, walletAddress)
+		if err != nil {
+			return err
+		}
+
+		if subscription == nil {
+			wc.Logger.Warnf("ignoring RevenueCat %s event %s for a period before the subscription expired", event.Type, event.Id)
+			record.Outcome = models.RevenueCatOutcomeRecorded
+			return nil
+		}
+
+		purchase.StoreSubscriptionID = &subscription.ID
+	}
+
+	// Free trials are paid out when the first paid renewal arrives, so that starting and cancelling
+	// trials does not collect tokens.
+	if event.IsUnpaid() {
+		record.Outcome = models.RevenueCatOutcomeRecorded
+		return nil
+	}
+
+	err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&purchase).Error
+	if err != nil {
+		return errors.New("failed to create purchase: " + err.Error())
+	}
+
+	record.Outcome = models.RevenueCatOutcomeQueued
+	if purchase.ID != 0 {
+		record.PurchaseID = &purchase.ID
+	}
+
+	return nil
+}
+
+func (wc WalletController) recordRevenueCatCancellation(tx *gorm.DB, event revenuecat.Event, record *models.RevenueCatEvent) error {
+	isRefund := event.Type == revenuecat.EventTypeRefund || event.CancelReason == revenueCatCancelReasonRefund
+
+	purchase, err := findRevenueCatPurchase(tx, event)
+	if err != nil {
+		return errors.New("failed to get purchase: " + err.Error())
+	}
+
+	if purchase == nil {
+		wc.Logger.Warnf("no purchase found for RevenueCat %s event %s", event.Type, event.Id)
+		return nil
+	}
+
+	// Turning off auto-renewal does not affect periods that were already paid for.
+	if purchase.StoreSubscriptionID != nil && !isRefund {
+		return nil
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"cancelled_at":        now,
+		"cancellation_reason": optionalString(event.CancelReason),
+	}
+
+	if isRefund {
+		updates["refunded_at"] = now
+
+		if purchase.IsRedeemed {
+			wc.Logger.Warnf("purchase %d of wallet %s was refunded after its tokens were sent", purchase.ID, purchase.Address)
+		}
+	}
+
+	err = tx.Model(&models.Purchase{}).Where("id = ?", purchase.ID).Updates(updates).Error
+	if err != nil {
+		return errors.New("failed to update purchase: " + err.Error())
+	}
+
+	if isRefund {
+		err = downgradeRefundedWallet(tx, purchase.Address)
+		if err != nil {
+			return errors.New("failed to downgrade wallet tier: " + err.Error())
+		}
+	}
+
+	record.Outcome = models.RevenueCatOutcomeRecorded
+	record.PurchaseID = &purchase.ID
+
+	return nil
+}
+
+// downgradeRefundedWallet moves the wallet back to the free tier when no paid purchase is left after a
+// refund. The fee grant is marked as expiring so RenewFeeGrants re-grants it with the free tier policy.
+func downgradeRefundedWallet(tx *gorm.DB, walletAddress string) error {
+	var count int64
+	err := tx.Model(&models.Purchase{}).
+		Where("address = ? AND source = ? AND is_redeemed = TRUE AND refunded_at IS NULL", walletAddress, models.PurchaseSourcePurchase).
+		Count(&count).
+		Error
+	if err != nil || count > 0 {
+		return err
+	}
+
+	return tx.Model(&models.Wallet{}).Where("address = ? AND tier = ?", walletAddress, feegrant.TierPaid).Updates(map[string]interface{}{
+		"tier":                 feegrant.TierFree,
+		"fee_grant_expires_at": time.Now(),
+	}).Error
+}
+
+// findRevenueCatPurchase returns the purchase the event refers to, or nil if there is none. All
+// periods of a subscription share the original transaction ID, so it is only used to match
+// purchases that are not part of a subscription.
+func findRevenueCatPurchase(tx *gorm.DB, event revenuecat.Event) (*models.Purchase, error) {
+	var purchases []models.Purchase
+
+	if event.TransactionId != "" {
+		err := tx.Where("source = ? AND transaction_id = ?", models.PurchaseSourcePurchase, event.TransactionId).
+			Order("id desc").
+			Limit(1).
+			Find(&purchases).
+			Error
+		if err != nil || len(purchases) > 0 {
+			return firstPurchase(purchases), err
+		}
+	}
+
+	if event.OriginalTransactionId != "" {
+		err := tx.Where("source = ? AND store_subscription_id IS NULL AND (transaction_id = ? OR original_transaction_id = ?)", models.PurchaseSourcePurchase, event.OriginalTransactionId, event.OriginalTransactionId).
+			Order("id desc").
+			Limit(1).
+			Find(&purchases).
+			Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return firstPurchase(purchases), nil
+}
+
+func firstPurchase(purchases []models.Purchase) *models.Purchase {
+	if len(purchases) == 0 {
+		return nil
+	}
+
+	return &purchases[0]
+}
+
+// renewStoreSubscription starts a new period of the subscription the event belongs to, creating the
+// subscription on its first purchase. It returns nil when the event is for a period that started
+// before the subscription expired, which happens when RevenueCat delivers events out of order.
+func (wc WalletController) renewStoreSubscription(tx *gorm.DB, event revenuecat.Event, walletAddress string) (*models.StoreSubscription, error) {
+	originalTransactionId := subscriptionTransactionId(event)
+	if originalTransactionId == "" {
+		return nil, errRevenueCatMissingTransaction
+	}
+
+	var subscription models.StoreSubscription
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("original_transaction_id = ?", originalTransactionId).First(&subscription).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("failed to get subscription: " + err.Error())
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		subscription = models.StoreSubscription{
+			Address:                walletAddress,
+			Store:                  event.Store,
+			ProductId:              event.ProductId,
+			OriginalTransactionId:  originalTransactionId,
+			Status:                 models.StoreSubscriptionStatusActive,
+			PeriodType:             event.PeriodType,
+			CurrentPeriodStartedAt: event.PurchasedAt(),
+			CurrentPeriodEndsAt:    event.ExpirationAt(),
+		}
+
+		err = tx.Create(&subscription).Error
+		if err != nil {
+			return nil, errors.New("failed to create subscription: " + err.Error())
+		}
+
+		return &subscription, nil
+	}
+
+	startedAt := event.PurchasedAt()
+	if subscription.Status == models.StoreSubscriptionStatusExpired && subscription.ExpiredAt != nil &&
+		startedAt != nil && startedAt.Before(*subscription.ExpiredAt) {
+		return nil, nil
+	}
+
+	renewals := subscription.Renewals
+	if event.Type == revenuecat.EventTypeRenewal {
+		renewals++
+	}
+
+	err = tx.Model(&subscription).Updates(map[string]interface{}{
+		"address":                   walletAddress,
+		"product_id":                event.ProductId,
+		"status":                    models.StoreSubscriptionStatusActive,
+		"period_type":               event.PeriodType,
+		"renewals":                  renewals,
+		"current_period_started_at": startedAt,
+		"current_period_ends_at":    event.ExpirationAt(),
+		"grace_period_ends_at":      nil,
+		"expired_at":                nil,
+		"expiration_reason":         nil,
+	}).Error
+	if err != nil {
+		return nil, errors.New("failed to update subscription: " + err.Error())
+	}
+
+	return &subscription, nil
+}
+
+// recordRevenueCatSubscriptionChange applies billing issues, expirations and auto-renewal changes to
+// the subscription the event belongs to. Events for products that are not subscriptions match nothing.
+func (wc WalletController) recordRevenueCatSubscriptionChange(tx *gorm.DB, event revenuecat.Event, record *models.RevenueCatEvent) error {
+	originalTransactionId := subscriptionTransactionId(event)
+	if originalTransactionId == "" {
+		return nil
+	}
+
+	var subscription models.StoreSubscription
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("original_transaction_id = ?", originalTransactionId).First(&subscription).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return errors.New("failed to get subscription: " + err.Error())
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{}
+
+	switch event.Type {
+	case revenuecat.EventTypeCancellation, revenuecat.EventTypeRefund:
+		updates["auto_renew_cancelled_at"] = now
+	case revenuecat.EventTypeUncancellation:
+		updates["auto_renew_cancelled_at"] = nil
+	case revenuecat.EventTypeBillingIssue:
+		updates["status"] = models.StoreSubscriptionStatusBillingIssue
+		updates["grace_period_ends_at"] = event.GracePeriodExpirationAt()
+	case revenuecat.EventTypeExpiration:
+		expiredAt := event.ExpirationAt()
+		if expiredAt == nil {
+			expiredAt = &now
+		}
+
+		// An expiration of an earlier period can arrive after the renewal that followed it.
+		if subscription.CurrentPeriodEndsAt != nil && expiredAt.Before(*subscription.CurrentPeriodEndsAt) {
+			wc.Logger.Warnf("ignoring RevenueCat expiration event %s for an earlier period of subscription %d", event.Id, subscription.ID)
+			record.Outcome = models.RevenueCatOutcomeRecorded
+			return nil
+		}
+
+		updates["status"] = models.StoreSubscriptionStatusExpired
+		updates["expired_at"] = expiredAt
+		updates["expiration_reason"] = optionalString(event.ExpirationReason)
+	}
+
+	err = tx.Model(&subscription).Updates(updates).Error
+	if err != nil {
+		return errors.New("failed to update subscription: " + err.Error())
+	}
+
+	record.Outcome = models.RevenueCatOutcomeRecorded
+
+	return nil
+}
+
+// subscriptionTransactionId returns the ID shared by all periods of the subscription the event
+// belongs to.
+func subscriptionTransactionId(event revenuecat.Event) string {
+	if event.OriginalTransactionId != "" {
+		return event.OriginalTransactionId
+	}
+
+	return event.TransactionId
+}
+
+// findRevenueCatWallet returns the first app user ID or alias of the event that is a valid wallet
+// address, since purchases made before the app identified the user carry an anonymous app user ID.
+func (wc WalletController) findRevenueCatWallet(event revenuecat.Event) string {
+	for _, id := range event.UserIds() {
+		if strings.HasPrefix(id, "$RCAnonymousID:") {
+			continue
+		}
+
+		walletAddress, err := wc.Addresses.NormalizeAccount(id)
+		if err == nil {
+			return walletAddress
+		}
+	}
+
+	return ""
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
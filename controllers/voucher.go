@@ -0,0 +1,338 @@
+package controllers
+
+import (
+	"dvpn/middleware"
+	"dvpn/models"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	voucherCodeLength   = 12
+	maxVoucherBatchSize = 10000
+)
+
+var voucherCodePattern = regexp.MustCompile(`^[A-Z0-9-]{4,32}$`)
+
+var (
+	errVoucherNotFound        = errors.New("voucher not found")
+	errVoucherExpired         = errors.New("voucher expired")
+	errVoucherFullyRedeemed   = errors.New("voucher fully redeemed")
+	errVoucherAlreadyRedeemed = errors.New("a voucher of this campaign was already redeemed by this wallet")
+)
+
+type VoucherController struct {
+	DB           *gorm.DB
+	Logger       *zap.SugaredLogger
+	DefaultDenom string
+}
+
+func (vc VoucherController) RedeemVoucher(c *gin.Context) {
+	type requestPayload struct {
+		Code string `json:"code"`
+	}
+
+	var payload requestPayload
+	if err := c.BindJSON(&payload); err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid request payload: "+err.Error())
+		return
+	}
+
+	code := strings.ToUpper(strings.TrimSpace(payload.Code))
+	if !voucherCodePattern.MatchString(code) {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid voucher code")
+		return
+	}
+
+	var wallet models.Wallet
+	tx := vc.DB.First(&wallet, "address = ? AND deregistered_at IS NULL", c.GetString(middleware.WalletAddressKey))
+	if tx.Error != nil {
+		if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			middleware.RespondErr(c, middleware.APIErrorNotFound, "wallet not registered")
+			return
+		}
+
+		reason := "failed to get wallet: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		vc.Logger.Error(reason)
+		return
+	}
+
+	var purchase models.Purchase
+
+	err := vc.DB.Transaction(func(tx *gorm.DB) error {
+		var voucher models.Voucher
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Batch").First(&voucher, "code = ?", code).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errVoucherNotFound
+			}
+
+			return err
+		}
+
+		if voucher.Batch.ExpiresAt != nil && voucher.Batch.ExpiresAt.Before(time.Now()) {
+			return errVoucherExpired
+		}
+
+		if voucher.Redemptions >= voucher.Batch.MaxRedemptions {
+			return errVoucherFullyRedeemed
+		}
+
+		var redemptions int64
+		err = tx.Model(&models.VoucherRedemption{}).Where("batch_id = ? AND wallet_id = ?", voucher.BatchID, wallet.ID).Count(&redemptions).Error
+		if err != nil {
+			return err
+		}
+
+		if redemptions > 0 {
+			return errVoucherAlreadyRedeemed
+		}
+
+		purchase = models.Purchase{
+			EventId: fmt.Sprintf("voucher-%d-%d", voucher.BatchID, wallet.ID),
+			Address: wallet.Address,
+			Amount:  voucher.Batch.Amount,
+			Denom:   voucher.Batch.Denom,
+			Source:  models.PurchaseSourceVoucher,
+		}
+
+		err = tx.Create(&purchase).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Create(&models.VoucherRedemption{
+			BatchID:    voucher.BatchID,
+			WalletID:   wallet.ID,
+			VoucherID:  voucher.ID,
+			PurchaseID: purchase.ID,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&voucher).Update("redemptions", gorm.Expr("redemptions + 1")).Error
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errVoucherNotFound):
+			middleware.RespondErr(c, middleware.APIErrorNotFound, err.Error())
+		case errors.Is(err, errVoucherExpired), errors.Is(err, errVoucherFullyRedeemed), errors.Is(err, errVoucherAlreadyRedeemed):
+			middleware.RespondErr(c, middleware.APIErrorInvalidRequest, err.Error())
+		case strings.Contains(err.Error(), "duplicate key value violates unique constraint"):
+			middleware.RespondErr(c, middleware.APIErrorInvalidRequest, errVoucherAlreadyRedeemed.Error())
+		default:
+			reason := "failed to redeem voucher: " + err.Error()
+			middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+			vc.Logger.Error(reason)
+		}
+		return
+	}
+
+	vc.Logger.Infof("wallet %s redeemed voucher %s", wallet.Address, code)
+	middleware.RespondOK(c, purchase)
+}
+
+func (vc VoucherController) CreateBatch(c *gin.Context) {
+	type requestPayload struct {
+		Name           string     `json:"name"`
+		Amount         int64      `json:"amount"`
+		Denom          string     `json:"denom"`
+		Count          int        `json:"count"`
+		MaxRedemptions int64      `json:"max_redemptions"`
+		ExpiresAt      *time.Time `json:"expires_at"`
+		Code           string     `json:"code"`
+	}
+
+	var payload requestPayload
+	if err := c.BindJSON(&payload); err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid request payload: "+err.Error())
+		return
+	}
+
+	if strings.TrimSpace(payload.Name) == "" {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "name is required")
+		return
+	}
+
+	if payload.Amount <= 0 {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "amount must be positive")
+		return
+	}
+
+	if payload.Denom == "" {
+		payload.Denom = vc.DefaultDenom
+	}
+
+	if payload.MaxRedemptions == 0 {
+		payload.MaxRedemptions = 1
+	}
+
+	if payload.MaxRedemptions < 0 {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "max_redemptions must be positive")
+		return
+	}
+
+	if payload.ExpiresAt != nil && payload.ExpiresAt.Before(time.Now()) {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "expires_at must be in the future")
+		return
+	}
+
+	var codes []string
+	if payload.Code != "" {
+		code := strings.ToUpper(strings.TrimSpace(payload.Code))
+		if !voucherCodePattern.MatchString(code) {
+			middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid voucher code")
+			return
+		}
+
+		if payload.Count > 1 {
+			middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "count must be 1 for a custom code")
+			return
+		}
+
+		codes = append(codes, code)
+	} else {
+		if payload.Count < 1 || payload.Count > maxVoucherBatchSize {
+			middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "count must be between 1 and "+strconv.Itoa(maxVoucherBatchSize))
+			return
+		}
+
+		seen := make(map[string]bool)
+		for len(codes) < payload.Count {
+			code, err := generateCode(voucherCodeLength)
+			if err != nil {
+				reason := "failed to generate voucher code: " + err.Error()
+				middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+				vc.Logger.Error(reason)
+				return
+			}
+
+			if !seen[code] {
+				seen[code] = true
+				codes = append(codes, code)
+			}
+		}
+	}
+
+	batch := models.VoucherBatch{
+		Name:           strings.TrimSpace(payload.Name),
+		Amount:         payload.Amount,
+		Denom:          payload.Denom,
+		MaxRedemptions: payload.MaxRedemptions,
+		ExpiresAt:      payload.ExpiresAt,
+		Codes:          int64(len(codes)),
+	}
+
+	err := vc.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&batch).Error
+		if err != nil {
+			return err
+		}
+
+		vouchers := make([]models.Voucher, 0, len(codes))
+		for _, code := range codes {
+			vouchers = append(vouchers, models.Voucher{
+				BatchID: batch.ID,
+				Code:    code,
+			})
+		}
+
+		return tx.CreateInBatches(&vouchers, 1000).Error
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "voucher code already exists")
+			return
+		}
+
+		reason := "failed to create voucher batch: " + err.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		vc.Logger.Error(reason)
+		return
+	}
+
+	vc.Logger.Infof("created voucher batch %d (%s) with %d codes", batch.ID, batch.Name, batch.Codes)
+	middleware.RespondOK(c, batch)
+}
+
+func (vc VoucherController) GetBatches(c *gin.Context) {
+	var batches []models.VoucherBatch
+	tx := vc.DB.Order("id desc").Find(&batches)
+	if tx.Error != nil {
+		reason := "failed to get voucher batches: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		vc.Logger.Error(reason)
+		return
+	}
+
+	middleware.RespondOK(c, batches)
+}
+
+func (vc VoucherController) ExportBatch(c *gin.Context) {
+	batchId, err := strconv.ParseUint(c.Params.ByName("batch_id"), 10, 64)
+	if err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid batch id: "+err.Error())
+		return
+	}
+
+	var batch models.VoucherBatch
+	tx := vc.DB.First(&batch, batchId)
+	if tx.Error != nil {
+		if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			middleware.RespondErr(c, middleware.APIErrorNotFound, "voucher batch not found")
+			return
+		}
+
+		reason := "failed to get voucher batch: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		vc.Logger.Error(reason)
+		return
+	}
+
+	var vouchers []models.Voucher
+	tx = vc.DB.Where("batch_id = ?", batch.ID).Order("id").Find(&vouchers)
+	if tx.Error != nil {
+		reason := "failed to get vouchers: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		vc.Logger.Error(reason)
+		return
+	}
+
+	expiresAt := ""
+	if batch.ExpiresAt != nil {
+		expiresAt = batch.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="vouchers-%d.csv"`, batch.ID))
+	c.Status(200)
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write([]string{"code", "amount", "denom", "max_redemptions", "redemptions", "expires_at"})
+	for _, voucher := range vouchers {
+		writer.Write([]string{
+			voucher.Code,
+			strconv.FormatInt(batch.Amount, 10),
+			batch.Denom,
+			strconv.FormatInt(batch.MaxRedemptions, 10),
+			strconv.FormatInt(voucher.Redemptions, 10),
+			expiresAt,
+		})
+	}
+	writer.Flush()
+
+	if err := writer.Error(); err != nil {
+		vc.Logger.Error("failed to write voucher export: " + err.Error())
+	}
+}
@@ -1,85 +1,118 @@
 package controllers
 
 import (
+	"dvpn/internal/address"
+	"dvpn/internal/aggregates"
+	"dvpn/internal/clientip"
+	"dvpn/internal/i18n"
+	"dvpn/internal/protocols"
+	"dvpn/internal/recommender"
+	"dvpn/internal/semver"
 	"dvpn/middleware"
 	"dvpn/models"
 	"errors"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+	"golang.org/x/text/language"
 	"gorm.io/gorm"
+	"net"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type VPNController struct {
-	DB     *gorm.DB
-	Logger *zap.SugaredLogger
+	DB               *gorm.DB
+	Logger           *zap.SugaredLogger
+	ClientIPResolver *clientip.Resolver
+	Localizer        *i18n.Localizer
+	Protocols        *protocols.Registry
+	Aggregates       *aggregates.Cache
+	Addresses        address.Prefixes
 }
 
 func (vc VPNController) GetIPAddress(c *gin.Context) {
 	type result struct {
-		Ip        string  `json:"ip"`
-		Latitude  float64 `json:"latitude"`
-		Longitude float64 `json:"longitude"`
-	}
-
-	var ipAddr string
-
-	realIp := c.GetHeader("CF-Connecting-IP")
-	if realIp != "" {
-		ipAddr = realIp
-	} else {
-		forwardedIp := c.GetHeader("X-Forwarded-For")
-		if forwardedIp != "" {
-			parts := strings.Split(forwardedIp, ",")
-			if len(parts) > 0 {
-				ipAddr = strings.TrimSpace(parts[0])
-			}
-		} else {
-			remoteIp := c.RemoteIP()
-			if remoteIp != "" {
-				ipAddr = remoteIp
-			} else {
-				middleware.RespondErr(c, middleware.APIErrorUnknown, "failed to get IP address")
-				return
-			}
-		}
+		Ip             string  `json:"ip"`
+		Latitude       float64 `json:"latitude"`
+		Longitude      float64 `json:"longitude"`
+		CountryCode    *string `json:"country_code"`
+		Country        *string `json:"country"`
+		City           *string `json:"city"`
+		ASN            *int64  `json:"asn"`
+		ASOrganization *string `json:"as_organization"`
+		IsProtected    bool    `json:"is_protected"`
 	}
 
-	var network models.Network
-	tx := vc.DB.First(&network, "network >> inet '"+ipAddr+"'")
-	if tx.Error != nil {
-		middleware.RespondErr(c, middleware.APIErrorUnknown, "failed to find matching IP range for "+ipAddr+": "+tx.Error.Error())
+	ipAddr, err := vc.resolveClientIP(c)
+	if err != nil {
+		middleware.RespondErr(c, middleware.APIErrorUnknown, err.Error())
+		return
+	}
+
+	network, err := vc.findNetwork(ipAddr)
+	if err != nil {
+		middleware.RespondErr(c, middleware.APIErrorUnknown, "failed to find matching IP range for "+ipAddr+": "+err.Error())
 		return
 	}
 
 	resultObject := result{
-		Ip:        ipAddr,
-		Latitude:  network.Latitude,
-		Longitude: network.Longitude,
+		Ip:             ipAddr,
+		Latitude:       network.Latitude,
+		Longitude:      network.Longitude,
+		CountryCode:    network.CountryCode,
+		City:           network.City,
+		ASN:            network.ASN,
+		ASOrganization: network.ASOrganization,
+	}
+
+	if network.CountryCode != nil {
+		var country models.Country
+		tx := vc.DB.First(&country, "code = ?", strings.ToUpper(*network.CountryCode))
+		if tx.Error == nil {
+			resultObject.Country = &country.Name
+		} else if !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			vc.Logger.Errorf("failed to get country %s: %s", *network.CountryCode, tx.Error)
+		}
+	}
+
+	var protectedServers int64
+	tx := vc.DB.Model(&models.Server{}).Where("is_active = ? AND id IN (?)", true, vc.DB.Model(&models.ServerRemoteIP{}).Select("server_id").Where("ip = ?::inet", ipAddr)).Count(&protectedServers)
+	if tx.Error != nil {
+		reason := "failed to check whether IP address belongs to a server: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		vc.Logger.Error(reason)
+		return
 	}
 
+	resultObject.IsProtected = protectedServers > 0
+
 	middleware.RespondOK(c, resultObject)
 }
 
 func (vc VPNController) GetCountries(c *gin.Context) {
-	var countries []models.Country
-	var tx *gorm.DB
-
-	protocol := c.Query("protocol")
-	if protocol != "" && protocol != "ALL" {
-		tx = vc.DB.Raw("SELECT c.id, c.created_at, c.updated_at, c.name, c.code, COUNT(s.id) as servers_available FROM countries AS c INNER JOIN servers AS s ON s.country_id = c.id WHERE s.is_active = true AND s.is_banned = false AND s.protocol = ? GROUP BY c.id ORDER BY c.name", protocol).Scan(&countries)
-	} else {
-		tx = vc.DB.Raw("SELECT c.id, c.created_at, c.updated_at, c.name, c.code, COUNT(s.id) as servers_available FROM countries AS c INNER JOIN servers AS s ON s.country_id = c.id WHERE s.is_active = true AND s.is_banned = false GROUP BY c.id ORDER BY c.name").Scan(&countries)
+	protocolNames, ok := vc.requestedProtocols(c)
+	if !ok {
+		return
 	}
 
-	if tx.Error != nil {
-		reason := "failed to get countries: " + tx.Error.Error()
+	countries, err := vc.Aggregates.Countries(protocolNames)
+	if err != nil {
+		reason := "failed to get countries: " + err.Error()
 		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
 		vc.Logger.Error(reason)
 		return
 	}
 
+	tag := vc.negotiateLanguage(c)
+	vc.localizeCountries(countries, tag)
+
+	collator := i18n.Collator(tag)
+	sort.SliceStable(countries, func(i, j int) bool {
+		return collator.CompareString(countries[i].Name, countries[j].Name) < 0
+	})
+
 	middleware.RespondOK(c, countries)
 }
 
@@ -90,27 +123,30 @@ func (vc VPNController) GetCities(c *gin.Context) {
 		return
 	}
 
-	var cities []models.City
-	var tx *gorm.DB
+	protocolNames, ok := vc.requestedProtocols(c)
+	if !ok {
+		return
+	}
 
-	protocol := c.Query("protocol")
-	if protocol != "" && protocol != "ALL" {
-		tx = vc.DB.Raw("SELECT c.id, c.created_at, c.updated_at, c.country_id, c.name, COUNT(s.id) as servers_available FROM cities AS c INNER JOIN servers AS s ON s.city_id = c.id WHERE s.is_active = true AND s.is_banned = false AND s.protocol = ? AND c.country_id = ? GROUP BY c.id ORDER BY servers_available DESC", protocol, countryId).Scan(&cities)
-	} else {
-		tx = vc.DB.Raw("SELECT c.id, c.created_at, c.updated_at, c.country_id, c.name, COUNT(s.id) as servers_available FROM cities AS c INNER JOIN servers AS s ON s.city_id = c.id WHERE s.is_active = true AND s.is_banned = false AND c.country_id = ? GROUP BY c.id ORDER BY servers_available DESC", countryId).Scan(&cities)
+	cities, err := vc.Aggregates.Cities(uint(countryId), protocolNames)
+	if err != nil {
+		reason := "failed to get cities: " + err.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		vc.Logger.Error(reason)
+		return
 	}
 
-	if tx.Error != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			middleware.RespondOK(c, []models.City{})
-			return
-		} else {
-			reason := "failed to get cities: " + err.Error()
-			middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
-			vc.Logger.Error(reason)
-			return
+	tag := vc.negotiateLanguage(c)
+	vc.localizeCities(cities, tag)
+
+	collator := i18n.Collator(tag)
+	sort.SliceStable(cities, func(i, j int) bool {
+		if cities[i].ServersAvailable != cities[j].ServersAvailable {
+			return cities[i].ServersAvailable > cities[j].ServersAvailable
 		}
-	}
+
+		return collator.CompareString(cities[i].Name, cities[j].Name) < 0
+	})
 
 	middleware.RespondOK(c, cities)
 }
@@ -130,7 +166,7 @@ func (vc VPNController) GetServers(c *gin.Context) {
 
 	var servers []models.Server
 
-	query := vc.DB.Model(&models.Server{}).Where("country_id = ? AND city_id = ? AND is_active = ? AND is_banned = ?", countryId, cityId, true, false)
+	query := vc.DB.Model(&models.Server{}).Preload("Country").Preload("City").Preload("Reliability").Where("servers.country_id = ? AND servers.city_id = ? AND servers.is_active = ? AND servers.is_banned = ? AND servers.is_version_supported = ?", countryId, cityId, true, false, true)
 
 	sortBy := c.Query("sortBy")
 	if sortBy != "" {
@@ -138,6 +174,9 @@ func (vc VPNController) GetServers(c *gin.Context) {
 		case "CURRENT_LOAD":
 			query = query.Order("current_load desc")
 			break
+		case "RELIABILITY":
+			query = query.Joins("LEFT JOIN server_reliabilities ON server_reliabilities.server_id = servers.id").Order("server_reliabilities.score DESC NULLS LAST")
+			break
 		default:
 			middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid sortBy")
 			return
@@ -166,19 +205,390 @@ func (vc VPNController) GetServers(c *gin.Context) {
 		query = query.Limit(limit)
 	}
 
-	protocol := c.Query("protocol")
-	if protocol != "" && protocol != "ALL" {
-		switch protocol {
-		case "WIREGUARD", "V2RAY":
-			query = query.Where("protocol = ?", protocol)
-			break
-		default:
+	protocolNames, ok := vc.requestedProtocols(c)
+	if !ok {
+		return
+	}
+
+	query = query.Where("servers.protocol IN ?", protocolNames)
+
+	tx := query.Find(&servers)
+	if tx.Error != nil {
+		reason := "failed to get servers: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		vc.Logger.Error(reason)
+		return
+	}
+
+	vc.localizeServers(servers, vc.negotiateLanguage(c))
+
+	middleware.RespondOK(c, servers)
+}
+
+func (vc VPNController) GetServer(c *gin.Context) {
+	type result struct {
+		ID                 uint                       `json:"id"`
+		Name               string                     `json:"name"`
+		Address            string                     `json:"address"`
+		Protocol           string                     `json:"protocol"`
+		CountryID          uint                       `json:"country_id"`
+		CountryName        string                     `json:"country_name"`
+		CountryCode        string                     `json:"country_code"`
+		CityID             uint                       `json:"city_id"`
+		CityName           string                     `json:"city_name"`
+		IsAvailable        bool                       `json:"is_available"`
+		IsBanned           bool                       `json:"is_banned"`
+		IsVersionSupported bool                       `json:"is_version_supported"`
+		BanReason          *string                    `json:"ban_reason"`
+		Load               float64                    `json:"load"`
+		Configuration      models.ServerConfiguration `json:"configuration"`
+		Reliability        *models.ServerReliability  `json:"reliability"`
+		Revision           int64                      `json:"revision"`
+		RevisionAt         time.Time                  `json:"revision_at"`
+		CreatedAt          time.Time                  `json:"created_at"`
+		UpdatedAt          time.Time                  `json:"updated_at"`
+	}
+
+	serverAddress, err := vc.Addresses.NormalizeNode(c.Params.ByName("address"))
+	if err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid server address: "+err.Error())
+		return
+	}
+
+	var server models.Server
+	tx := vc.DB.Preload("Country").Preload("City").Preload("Reliability").Order("id").First(&server, "address = ?", serverAddress)
+	if tx.Error != nil {
+		if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			middleware.RespondErr(c, middleware.APIErrorNotFound, "server not found")
+			return
+		}
+
+		reason := "failed to get server: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		vc.Logger.Error(reason)
+		return
+	}
+
+	tag := vc.negotiateLanguage(c)
+
+	countries := []models.Country{server.Country}
+	vc.localizeCountries(countries, tag)
+
+	cities := []models.City{server.City}
+	vc.localizeCities(cities, tag)
+
+	middleware.RespondOK(c, result{
+		ID:                 server.ID,
+		Name:               server.Name,
+		Address:            server.Address,
+		Protocol:           string(server.Protocol),
+		CountryID:          server.CountryID,
+		CountryName:        countries[0].Name,
+		CountryCode:        server.Country.Code,
+		CityID:             server.CityID,
+		CityName:           cities[0].Name,
+		IsAvailable:        server.IsActive,
+		IsBanned:           server.IsBanned,
+		IsVersionSupported: server.IsVersionSupported,
+		BanReason:          server.BanReason,
+		Load:               server.CurrentLoad,
+		Configuration:      server.Configuration.Data(),
+		Reliability:        server.Reliability,
+		Revision:           server.Revision,
+		RevisionAt:         time.Unix(server.Revision, 0).UTC(),
+		CreatedAt:          server.CreatedAt,
+		UpdatedAt:          server.UpdatedAt,
+	})
+}
+
+// GetServerChanges returns the servers added, changed and removed since a catalog revision. Servers
+// of protocols the app does not support are left out. The load and bandwidth of unchanged servers
+// may be stale by up to one bucket of hashServer; clients refresh them with POST /servers.
+func (vc VPNController) GetServerChanges(c *gin.Context) {
+	type result struct {
+		Revision int64           `json:"revision"`
+		Resync   bool            `json:"resync"`
+		Added    []models.Server `json:"added"`
+		Changed  []models.Server `json:"changed"`
+		Removed  []string        `json:"removed"`
+	}
+
+	since, err := strconv.ParseInt(c.Query("since"), 10, 64)
+	if err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid since revision: "+err.Error())
+		return
+	}
+
+	var bounds struct {
+		Oldest *int64
+		Latest *int64
+	}
+
+	tx := vc.DB.Model(&models.CatalogRevision{}).Select("MIN(revision) AS oldest, MAX(revision) AS latest").Scan(&bounds)
+	if tx.Error != nil {
+		reason := "failed to get catalog revisions: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		vc.Logger.Error(reason)
+		return
+	}
+
+	response := result{
+		Added:   []models.Server{},
+		Changed: []models.Server{},
+		Removed: []string{},
+	}
+
+	if bounds.Latest == nil {
+		response.Resync = true
+		middleware.RespondOK(c, response)
+		return
+	}
+
+	response.Revision = *bounds.Latest
+
+	if since < *bounds.Oldest || since > *bounds.Latest {
+		response.Resync = true
+		middleware.RespondOK(c, response)
+		return
+	}
+
+	var entries []models.CatalogEntry
+	tx = vc.DB.Where("changed_revision > ? OR removed_revision > ?", since, since).Find(&entries)
+	if tx.Error != nil {
+		reason := "failed to get catalog changes: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		vc.Logger.Error(reason)
+		return
+	}
+
+	var serverIds []uint
+	isAdded := make(map[uint]bool)
+
+	for _, entry := range entries {
+		if entry.RemovedRevision != nil {
+			if entry.AddedRevision <= since {
+				response.Removed = append(response.Removed, entry.Address)
+			}
+			continue
+		}
+
+		serverIds = append(serverIds, entry.ServerID)
+		isAdded[entry.ServerID] = entry.AddedRevision > since
+	}
+
+	if len(serverIds) > 0 {
+		var servers []models.Server
+		tx = vc.DB.Model(&models.Server{}).Preload("Country").Preload("City").Preload("Reliability").Where("id IN ? AND protocol IN ?", serverIds, protocols.Names(vc.supportedProtocols(c))).Find(&servers)
+		if tx.Error != nil {
+			reason := "failed to get servers: " + tx.Error.Error()
+			middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+			vc.Logger.Error(reason)
+			return
+		}
+
+		vc.localizeServers(servers, vc.negotiateLanguage(c))
+
+		for _, server := range servers {
+			if isAdded[server.ID] {
+				response.Added = append(response.Added, server)
+			} else {
+				response.Changed = append(response.Changed, server)
+			}
+		}
+	}
+
+	middleware.RespondOK(c, response)
+}
+
+func (vc VPNController) GetProtocols(c *gin.Context) {
+	middleware.RespondOK(c, vc.supportedProtocols(c))
+}
+
+func (vc VPNController) GetServerVersions(c *gin.Context) {
+	type versionCount struct {
+		Protocol    string `json:"protocol"`
+		Version     string `json:"version"`
+		IsSupported bool   `json:"is_supported"`
+		Servers     int64  `json:"servers"`
+	}
+
+	var counts []versionCount
+	tx := vc.DB.Raw("SELECT protocol, configuration->>'version' AS version, is_version_supported AS is_supported, COUNT(id) AS servers FROM servers WHERE is_active = true AND is_banned = false GROUP BY protocol, configuration->>'version', is_version_supported").Scan(&counts)
+	if tx.Error != nil {
+		reason := "failed to get server versions: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		vc.Logger.Error(reason)
+		return
+	}
+
+	sort.SliceStable(counts, func(i, j int) bool {
+		if counts[i].Protocol != counts[j].Protocol {
+			return counts[i].Protocol < counts[j].Protocol
+		}
+
+		versionA, errA := semver.Parse(counts[i].Version)
+		versionB, errB := semver.Parse(counts[j].Version)
+		if errA != nil || errB != nil {
+			return errB != nil && errA == nil
+		}
+
+		return versionA.Compare(versionB) > 0
+	})
+
+	middleware.RespondOK(c, counts)
+}
+
+func (vc VPNController) SubmitConnectionReport(c *gin.Context) {
+	type requestPayload struct {
+		IsSuccessful   *bool  `json:"is_successful"`
+		HandshakeMs    *int64 `json:"handshake_ms"`
+		ThroughputKbps *int64 `json:"throughput_kbps"`
+		Protocol       string `json:"protocol"`
+	}
+
+	var payload requestPayload
+	if err := c.BindJSON(&payload); err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid request payload: "+err.Error())
+		return
+	}
+
+	if payload.IsSuccessful == nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "missing is_successful")
+		return
+	}
+
+	if (payload.HandshakeMs != nil && *payload.HandshakeMs < 0) || (payload.ThroughputKbps != nil && *payload.ThroughputKbps < 0) {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid measurements")
+		return
+	}
+
+	protocol, ok := vc.Protocols.ByName(payload.Protocol)
+	if !ok {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid protocol")
+		return
+	}
+
+	serverAddress, err := vc.Addresses.NormalizeNode(c.Params.ByName("address"))
+	if err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid server address: "+err.Error())
+		return
+	}
+
+	var server models.Server
+	tx := vc.DB.Order("id").First(&server, "address = ?", serverAddress)
+	if tx.Error != nil {
+		if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			middleware.RespondErr(c, middleware.APIErrorNotFound, "server not found")
+			return
+		}
+
+		reason := "failed to get server: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		vc.Logger.Error(reason)
+		return
+	}
+
+	report := models.ConnectionReport{
+		ServerID:       server.ID,
+		IsSuccessful:   *payload.IsSuccessful,
+		HandshakeMs:    payload.HandshakeMs,
+		ThroughputKbps: payload.ThroughputKbps,
+		Protocol:       protocol.Name,
+	}
+
+	ip, err := vc.ClientIPResolver.ClientIP(c.Request)
+	if err != nil {
+		reason := "failed to get IP address: " + err.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		vc.Logger.Error(reason)
+		return
+	}
+
+	subnet := clientip.Subnet(ip).String()
+	report.ClientSubnet = &subnet
+
+	network, err := vc.findNetwork(ip.String())
+	if err == nil {
+		report.ClientCountryCode = network.CountryCode
+		report.ClientNetwork = &network.Network
+	}
+
+	// Reports are limited per client network, or per /24 (IPv4) or /48 (IPv6) subnet when the
+	// client IP address is not part of a known network.
+	recentReportsQuery := vc.DB.Model(&models.ConnectionReport{}).Where("server_id = ? AND client_subnet = ?::cidr AND created_at > ?", server.ID, subnet, time.Now().Add(-time.Hour))
+	if report.ClientNetwork != nil {
+		recentReportsQuery = vc.DB.Model(&models.ConnectionReport{}).Where("server_id = ? AND client_network = ? AND created_at > ?", server.ID, *report.ClientNetwork, time.Now().Add(-time.Hour))
+	}
+
+	var recentReports int64
+	tx = recentReportsQuery.Count(&recentReports)
+	if tx.Error != nil {
+		reason := "failed to count connection reports: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		vc.Logger.Error(reason)
+		return
+	}
+
+	if recentReports >= 10 {
+		middleware.RespondErr(c, middleware.APIErrorRateLimited, "too many connection reports")
+		return
+	}
+
+	tx = vc.DB.Create(&report)
+	if tx.Error != nil {
+		reason := "failed to create connection report: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		vc.Logger.Error(reason)
+		return
+	}
+
+	middleware.RespondOK(c, nil)
+}
+
+func (vc VPNController) GetRecommendedServers(c *gin.Context) {
+	request := recommender.Request{
+		Limit: 5,
+	}
+
+	limit := c.Query("limit")
+	if limit != "" {
+		limit, err := strconv.Atoi(limit)
+		if err != nil || limit <= 0 || limit > 25 {
+			middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid limit")
+			return
+		}
+
+		request.Limit = limit
+	}
+
+	protocol := protocols.NormalizeName(c.Query("protocol"))
+	if protocol != "" && protocol != protocols.All {
+		supportedProtocol, ok := vc.Protocols.ByName(protocol)
+		if !ok {
 			middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid protocol")
 			return
 		}
+
+		request.PreferredProtocol = supportedProtocol.Name
 	}
 
-	tx := query.Find(&servers)
+	protocolNames := protocols.Names(vc.supportedProtocols(c))
+
+	ipAddr, err := vc.resolveClientIP(c)
+	if err == nil {
+		network, err := vc.findNetwork(ipAddr)
+		if err == nil {
+			request.Location = &recommender.Location{
+				Latitude:  network.Latitude,
+				Longitude: network.Longitude,
+			}
+		} else {
+			vc.Logger.Warnf("failed to find matching IP range for %s, recommending without location: %s", ipAddr, err)
+		}
+	}
+
+	var servers []models.Server
+	tx := vc.DB.Model(&models.Server{}).Preload("Country").Preload("City").Preload("Reliability").Where("is_active = ? AND is_banned = ? AND is_version_supported = ? AND protocol IN ?", true, false, true, protocolNames).Find(&servers)
 	if tx.Error != nil {
 		reason := "failed to get servers: " + tx.Error.Error()
 		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
@@ -186,7 +596,149 @@ func (vc VPNController) GetServers(c *gin.Context) {
 		return
 	}
 
-	middleware.RespondOK(c, servers)
+	r := recommender.Recommender{Weights: recommender.DefaultWeights}
+	recommendations := r.Rank(servers, request)
+
+	ranked := make([]models.Server, len(recommendations))
+	for i, recommendation := range recommendations {
+		ranked[i] = recommendation.Server
+	}
+
+	vc.localizeServers(ranked, vc.negotiateLanguage(c))
+
+	for i := range recommendations {
+		recommendations[i].Server = ranked[i]
+	}
+
+	middleware.RespondOK(c, recommendations)
+}
+
+func (vc VPNController) supportedProtocols(c *gin.Context) []protocols.Protocol {
+	return vc.Protocols.SupportedBy(c.GetHeader("X-App-Platform"), c.GetHeader("X-App-Version"))
+}
+
+func (vc VPNController) requestedProtocols(c *gin.Context) ([]string, bool) {
+	supported := vc.supportedProtocols(c)
+
+	protocol := protocols.NormalizeName(c.Query("protocol"))
+	if protocol == "" || protocol == protocols.All {
+		return protocols.Names(supported), true
+	}
+
+	for _, supportedProtocol := range supported {
+		if string(supportedProtocol.Name) == protocol {
+			return []string{protocol}, true
+		}
+	}
+
+	middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid protocol")
+	return nil, false
+}
+
+func (vc VPNController) negotiateLanguage(c *gin.Context) language.Tag {
+	tag := vc.Localizer.Negotiate(c.GetHeader("Accept-Language"))
+	c.Header("Content-Language", tag.String())
+
+	return tag
+}
+
+func (vc VPNController) localizeCountries(countries []models.Country, tag language.Tag) {
+	if tag == language.English || len(countries) == 0 {
+		return
+	}
+
+	var ids []uint
+	for _, country := range countries {
+		ids = append(ids, country.ID)
+	}
+
+	var translations []models.CountryTranslation
+	tx := vc.DB.Where("language = ? AND country_id IN ?", tag.String(), ids).Find(&translations)
+	if tx.Error != nil {
+		vc.Logger.Errorf("failed to get %s country translations, falling back to English: %s", tag, tx.Error)
+		return
+	}
+
+	names := make(map[uint]string)
+	for _, translation := range translations {
+		names[translation.CountryID] = translation.Name
+	}
+
+	for i := range countries {
+		if name, ok := names[countries[i].ID]; ok {
+			countries[i].Name = name
+		}
+	}
+}
+
+func (vc VPNController) localizeCities(cities []models.City, tag language.Tag) {
+	if tag == language.English || len(cities) == 0 {
+		return
+	}
+
+	var ids []uint
+	for _, city := range cities {
+		ids = append(ids, city.ID)
+	}
+
+	var translations []models.CityTranslation
+	tx := vc.DB.Where("language = ? AND city_id IN ?", tag.String(), ids).Find(&translations)
+	if tx.Error != nil {
+		vc.Logger.Errorf("failed to get %s city translations, falling back to English: %s", tag, tx.Error)
+		return
+	}
+
+	names := make(map[uint]string)
+	for _, translation := range translations {
+		names[translation.CityID] = translation.Name
+	}
+
+	for i := range cities {
+		if name, ok := names[cities[i].ID]; ok {
+			cities[i].Name = name
+		}
+	}
+}
+
+// localizeServers localizes the names of the preloaded countries and cities of servers.
+func (vc VPNController) localizeServers(servers []models.Server, tag language.Tag) {
+	countries := make([]models.Country, len(servers))
+	cities := make([]models.City, len(servers))
+	for i, server := range servers {
+		countries[i] = server.Country
+		cities[i] = server.City
+	}
+
+	vc.localizeCountries(countries, tag)
+	vc.localizeCities(cities, tag)
+
+	for i := range servers {
+		servers[i].Country.Name = countries[i].Name
+		servers[i].City.Name = cities[i].Name
+	}
+}
+
+func (vc VPNController) resolveClientIP(c *gin.Context) (string, error) {
+	ip, err := vc.ClientIPResolver.ClientIP(c.Request)
+	if err != nil {
+		return "", errors.New("failed to get IP address: " + err.Error())
+	}
+
+	return ip.String(), nil
+}
+
+func (vc VPNController) findNetwork(ipAddr string) (*models.Network, error) {
+	if net.ParseIP(ipAddr) == nil {
+		return nil, errors.New("invalid IP address")
+	}
+
+	var network models.Network
+	tx := vc.DB.First(&network, "network >> ?::inet", ipAddr)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	return &network, nil
 }
 
 func (vc VPNController) GetServersByIds(c *gin.Context) {
@@ -200,8 +752,19 @@ func (vc VPNController) GetServersByIds(c *gin.Context) {
 		return
 	}
 
+	var addresses []string
+	for _, serverAddress := range payload.Addresses {
+		normalized, err := vc.Addresses.NormalizeNode(serverAddress)
+		if err != nil {
+			middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid server address "+serverAddress+": "+err.Error())
+			return
+		}
+
+		addresses = append(addresses, normalized)
+	}
+
 	var servers []models.Server
-	query := vc.DB.Model(&models.Server{}).Where("address IN ?", payload.Addresses)
+	query := vc.DB.Model(&models.Server{}).Preload("Country").Preload("City").Preload("Reliability").Where("address IN ?", addresses)
 	tx := query.Find(&servers)
 	if tx.Error != nil {
 		reason := "failed to get servers: " + tx.Error.Error()
@@ -210,5 +773,7 @@ func (vc VPNController) GetServersByIds(c *gin.Context) {
 		return
 	}
 
+	vc.localizeServers(servers, vc.negotiateLanguage(c))
+
 	middleware.RespondOK(c, servers)
 }
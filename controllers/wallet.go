@@ -1,24 +1,39 @@
 package controllers
 
 import (
-	"dvpn/internal/revenuecat"
+	"dvpn/internal/address"
+	"dvpn/internal/clientip"
+	"dvpn/internal/pow"
+	"dvpn/internal/products"
+	"dvpn/internal/sentinel"
 	"dvpn/middleware"
 	"dvpn/models"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
-	"os"
 	"strings"
+	"time"
 )
 
 type WalletController struct {
-	DB     *gorm.DB
-	Logger *zap.SugaredLogger
+	DB               *gorm.DB
+	Logger           *zap.SugaredLogger
+	Sentinel         *sentinel.Sentinel
+	Addresses        address.Prefixes
+	ClientIPResolver *clientip.Resolver
+	Registration     RegistrationLimits
+	Challenges       *pow.Issuer
+	UsedChallenges   pow.Registry
+	Products         *products.Catalog
 }
 
 func (wc WalletController) RegisterWallet(c *gin.Context) {
 	type requestPayload struct {
-		Address string `json:"address"`
+		Address      string `json:"address"`
+		Challenge    string `json:"challenge"`
+		Nonce        string `json:"nonce"`
+		ReferralCode string `json:"referral_code"`
 	}
 
 	var payload requestPayload
@@ -27,86 +42,318 @@ func (wc WalletController) RegisterWallet(c *gin.Context) {
 		return
 	}
 
-	if payload.Address == "" || len(payload.Address) != 43 || payload.Address == os.Getenv("SENTINEL_FEE_GRANTER_WALLET_ADDRESS") {
+	walletAddress, err := wc.Addresses.NormalizeAccount(payload.Address)
+	if err != nil {
+		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid wallet address: "+err.Error())
+		return
+	}
+
+	if walletAddress == wc.Sentinel.FeeGranterWalletAddress {
 		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid wallet address")
 		return
 	}
 
+	var existingWallets []models.Wallet
+	tx := wc.DB.Where("address = ?", walletAddress).Limit(1).Find(&existingWallets)
+	if tx.Error != nil {
+		reason := "failed to get wallet: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		wc.Logger.Error(reason)
+		return
+	}
+
+	if len(existingWallets) > 0 {
+		if existingWallets[0].DeregisteredAt != nil {
+			middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "wallet is deregistered")
+			return
+		}
+
+		// Registration is unauthenticated, so it must not count as activity of an existing wallet:
+		// only signed requests refresh last_seen_at and lift an inactivity revocation.
+		middleware.RespondOK(c, nil)
+		return
+	}
+
+	var referrer *models.Wallet
+	if payload.ReferralCode != "" {
+		referrer, err = wc.findReferrer(payload.ReferralCode)
+		if err != nil {
+			reason := "failed to get referrer: " + err.Error()
+			middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+			wc.Logger.Error(reason)
+			return
+		}
+
+		if referrer == nil {
+			middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid referral code")
+			return
+		}
+	}
+
+	ipAddr, subnet, ok := wc.checkRegistration(c, walletAddress, payload.Challenge, payload.Nonce)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
 	wallet := models.Wallet{
-		Address:      strings.ToLower(payload.Address),
-		IsFeeGranted: false,
+		Address:            walletAddress,
+		IsFeeGranted:       false,
+		LastSeenAt:         &now,
+		RegistrationIP:     &ipAddr,
+		RegistrationSubnet: &subnet,
 	}
 
-	tx := wc.DB.Create(&wallet)
-	if tx.Error != nil {
-		if strings.Contains(tx.Error.Error(), "duplicate key value violates unique constraint") == false {
-			reason := "failed to create wallet: " + tx.Error.Error()
+	limitReason, limitDetails, err := wc.createWallet(&wallet)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") == false {
+			reason := "failed to create wallet: " + err.Error()
 			middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
 			wc.Logger.Error(reason)
 			return
 		}
+
+		middleware.RespondOK(c, nil)
+		return
+	}
+
+	if limitReason != "" {
+		wc.rejectLimit(c, wallet, limitReason, limitDetails)
+		return
+	}
+
+	_, err = assignReferralCode(wc.DB, wallet)
+	if err != nil {
+		wc.Logger.Errorf("failed to assign referral code to wallet %s: %s", wallet.Address, err)
+	}
+
+	if referrer != nil {
+		tx = wc.DB.Create(&models.Referral{
+			ReferrerID: referrer.ID,
+			RefereeID:  wallet.ID,
+			Status:     models.ReferralStatusPending,
+		})
+		if tx.Error != nil {
+			wc.Logger.Errorf("failed to save referral of wallet %s: %s", wallet.Address, tx.Error)
+		}
 	}
 
 	middleware.RespondOK(c, nil)
 }
 
-func (wc WalletController) HandleRevenueCatWebhook(c *gin.Context) {
+const (
+	feeGrantStatePending = "PENDING"
+	feeGrantStateGranted = "GRANTED"
+	feeGrantStateExpired = "EXPIRED"
+)
+
+type walletTrial struct {
+	Amount     int64     `json:"amount"`
+	Denom      string    `json:"denom"`
+	IsRedeemed bool      `json:"is_redeemed"`
+	GrantedAt  time.Time `json:"granted_at"`
+}
+
+type walletSubscription struct {
+	ID          *int64     `json:"id"`
+	PlanID      string     `json:"plan_id"`
+	Status      string     `json:"status"`
+	AllocatedAt *time.Time `json:"allocated_at"`
+}
+
+type walletFeeGrant struct {
+	State     string     `json:"state"`
+	Tier      string     `json:"tier"`
+	Policy    *string    `json:"policy"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (wc WalletController) GetWalletStatus(c *gin.Context) {
+	type purchases struct {
+		Pending   []models.Purchase `json:"pending"`
+		Completed []models.Purchase `json:"completed"`
+	}
 
-	auth := c.GetHeader("Authorization")
-	if auth != os.Getenv("REVENUECAT_AUTH") {
-		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid authorization header")
+	type responseObject struct {
+		Address        string                     `json:"address"`
+		RegisteredAt   time.Time                  `json:"registered_at"`
+		DeregisteredAt *time.Time                 `json:"deregistered_at"`
+		FeeGrant       walletFeeGrant             `json:"fee_grant"`
+		Subscription   walletSubscription         `json:"subscription"`
+		Subscriptions  []models.StoreSubscription `json:"store_subscriptions"`
+		Trial          *walletTrial               `json:"trial"`
+		Purchases      purchases                  `json:"purchases"`
+		Balances       *[]sentinel.SentinelCoin   `json:"balances"`
+	}
+
+	var wallet models.Wallet
+	tx := wc.DB.First(&wallet, "address = ?", c.GetString(middleware.WalletAddressKey))
+	if tx.Error != nil {
+		if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			middleware.RespondErr(c, middleware.APIErrorNotFound, "wallet not registered")
+			return
+		}
+
+		reason := "failed to get wallet: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		wc.Logger.Error(reason)
 		return
 	}
 
-	var payload revenuecat.Payload
-	if err := c.BindJSON(&payload); err != nil {
-		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid request payload: "+err.Error())
+	err := touchWallet(wc.DB, wallet.Address)
+	if err != nil {
+		wc.Logger.Warnf("failed to update last seen time of wallet %s: %s", wallet.Address, err)
+	}
+
+	var walletPurchases []models.Purchase
+	tx = wc.DB.Where("address = ?", wallet.Address).Order("id desc").Find(&walletPurchases)
+	if tx.Error != nil {
+		reason := "failed to get purchases: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		wc.Logger.Error(reason)
 		return
 	}
 
-	if payload.Event.Id == "" {
-		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid event id")
+	result := responseObject{
+		Address:        wallet.Address,
+		RegisteredAt:   wallet.CreatedAt,
+		DeregisteredAt: wallet.DeregisteredAt,
+		FeeGrant:       wc.feeGrantStatus(wallet),
+		Subscription: walletSubscription{
+			ID:          wallet.PlanSubscriptionID,
+			PlanID:      wc.Sentinel.ProviderPlanBlockchainID,
+			Status:      wallet.PlanSubscriptionStatus,
+			AllocatedAt: wallet.PlanAllocatedAt,
+		},
+		Purchases: purchases{
+			Pending:   []models.Purchase{},
+			Completed: []models.Purchase{},
+		},
+	}
+
+	result.Subscriptions = []models.StoreSubscription{}
+	tx = wc.DB.Where("address = ?", wallet.Address).Order("id desc").Find(&result.Subscriptions)
+	if tx.Error != nil {
+		reason := "failed to get store subscriptions: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		wc.Logger.Error(reason)
 		return
 	}
 
-	if payload.Event.AppUserId == "" || len(payload.Event.AppUserId) != 43 {
-		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid wallet address")
+	var trialGrants []models.TrialGrant
+	tx = wc.DB.Preload("Purchase").Where("wallet_id = ? AND purchase_id IS NOT NULL", wallet.ID).Limit(1).Find(&trialGrants)
+	if tx.Error != nil {
+		reason := "failed to get trial grant: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		wc.Logger.Error(reason)
 		return
 	}
 
-	amount := 0
-	denom := "udvpn"
+	if len(trialGrants) > 0 && trialGrants[0].Purchase != nil {
+		result.Trial = &walletTrial{
+			Amount:     trialGrants[0].Purchase.Amount,
+			Denom:      trialGrants[0].Purchase.Denom,
+			IsRedeemed: trialGrants[0].Purchase.IsRedeemed,
+			GrantedAt:  trialGrants[0].CreatedAt,
+		}
+	}
 
-	switch payload.Event.ProductId {
-	case "sentinel_dvpn_5000":
-		amount = 5000 * 1000000
-	case "sentinel_dvpn_10000":
-		amount = 10000 * 1000000
-	case "sentinel_dvpn_15000":
-		amount = 15000 * 1000000
+	for _, purchase := range walletPurchases {
+		if purchase.IsRedeemed || purchase.RefundedAt != nil {
+			result.Purchases.Completed = append(result.Purchases.Completed, purchase)
+		} else {
+			result.Purchases.Pending = append(result.Purchases.Pending, purchase)
+		}
 	}
 
-	if amount == 0 {
-		middleware.RespondErr(c, middleware.APIErrorInvalidRequest, "invalid product id")
-		return
+	balances, err := wc.Sentinel.FetchBalances(wallet.Address)
+	if err != nil {
+		wc.Logger.Warnf("failed to fetch balances for wallet %s: %s", wallet.Address, err)
+	} else {
+		result.Balances = balances
+	}
+
+	middleware.RespondOK(c, result)
+}
+
+func (wc WalletController) feeGrantStatus(wallet models.Wallet) walletFeeGrant {
+	status := walletFeeGrant{
+		State:  feeGrantStatePending,
+		Tier:   wallet.Tier,
+		Policy: wallet.FeeGrantPolicy,
 	}
 
-	purchase := models.Purchase{
-		EventId: payload.Event.Id,
-		Address: strings.ToLower(payload.Event.AppUserId),
-		Amount:  int64(amount),
-		Denom:   denom,
+	if wallet.IsFeeGranted {
+		status.State = feeGrantStateExpired
 	}
 
-	tx := wc.DB.Create(&purchase)
-	if tx.Error == nil {
-		if strings.Contains(tx.Error.Error(), "duplicate key value violates unique constraint") == false {
-			reason := "failed to create purchase: " + tx.Error.Error()
-			middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
-			wc.Logger.Error(reason)
+	allowances, err := wc.Sentinel.FetchFeeGrantAllowances(wallet.Address, 100, 0)
+	if err != nil {
+		wc.Logger.Warnf("failed to fetch fee grant allowances for wallet %s: %s", wallet.Address, err)
+
+		if wallet.IsFeeGranted {
+			status.ExpiresAt = wallet.FeeGrantExpiresAt
+			if status.ExpiresAt == nil || status.ExpiresAt.After(time.Now()) {
+				status.State = feeGrantStateGranted
+			}
+		}
+
+		return status
+	}
+
+	if allowances == nil {
+		return status
+	}
+
+	for _, allowance := range *allowances {
+		if allowance.Grantee != wallet.Address || allowance.Granter != wc.Sentinel.FeeGranterWalletAddress {
+			continue
+		}
+
+		status.ExpiresAt = allowance.Allowance.Expiration
+		if status.ExpiresAt == nil || status.ExpiresAt.After(time.Now()) {
+			status.State = feeGrantStateGranted
+		} else {
+			status.State = feeGrantStateExpired
+		}
+	}
+
+	return status
+}
+
+// touchWallet records wallet activity and lifts an inactivity revocation so the wallet is enrolled again.
+// It must only be called for requests authenticated with the wallet signature.
+func touchWallet(db *gorm.DB, address string) error {
+	return db.Model(&models.Wallet{}).Where("address = ? AND deregistered_at IS NULL", address).Updates(map[string]interface{}{
+		"last_seen_at":         time.Now(),
+		"fee_grant_revoked_at": nil,
+	}).Error
+}
+
+func (wc WalletController) DeregisterWallet(c *gin.Context) {
+	erase := c.Query("erase") == "true"
+
+	var wallet models.Wallet
+	tx := wc.DB.First(&wallet, "address = ?", c.GetString(middleware.WalletAddressKey))
+	if tx.Error != nil {
+		if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			middleware.RespondErr(c, middleware.APIErrorNotFound, "wallet not registered")
 			return
 		}
+
+		reason := "failed to get wallet: " + tx.Error.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		wc.Logger.Error(reason)
+		return
 	}
 
-	middleware.RespondOK(c, nil)
+	revocation, err := deregisterWallet(wc.DB, wallet, models.WalletRevocationSourceUser, "user request", erase)
+	if err != nil {
+		reason := "failed to deregister wallet: " + err.Error()
+		middleware.RespondErr(c, middleware.APIErrorUnknown, reason)
+		wc.Logger.Error(reason)
+		return
+	}
+
+	middleware.RespondOK(c, revocation)
 }
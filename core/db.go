@@ -1,14 +1,17 @@
 package core
 
 import (
+	"dvpn/internal/i18n"
 	"dvpn/models"
 	"fmt"
 	"net"
 	"net/url"
 	"os"
 
+	"golang.org/x/text/language"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var db *gorm.DB
@@ -42,7 +45,7 @@ func InitDB() (*gorm.DB, error) {
 	return db, nil
 }
 
-func PopulateDB(db *gorm.DB) error {
+func PopulateDB(db *gorm.DB, languages []language.Tag) error {
 	var countries []models.Country
 	tx := db.Find(&countries)
 	if tx.Error != nil {
@@ -54,7 +57,64 @@ func PopulateDB(db *gorm.DB) error {
 		panic("No countries found")
 	}
 
-	return nil
+	err := populateCountryTranslations(db, countries, languages)
+	if err != nil {
+		return err
+	}
+
+	return populateProducts(db)
+}
+
+func populateCountryTranslations(db *gorm.DB, countries []models.Country, languages []language.Tag) error {
+	var translations []models.CountryTranslation
+
+	for _, tag := range languages {
+		if tag == language.English {
+			continue
+		}
+
+		for _, country := range countries {
+			name, ok := i18n.CountryName(tag, country.Code)
+			if !ok {
+				continue
+			}
+
+			translations = append(translations, models.CountryTranslation{
+				CountryID: country.ID,
+				Language:  tag.String(),
+				Name:      name,
+			})
+		}
+	}
+
+	if len(translations) == 0 {
+		return nil
+	}
+
+	tx := db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&translations, 500)
+	return tx.Error
+}
+
+// populateProducts seeds the token bundles that were sold before the product catalog existed.
+func populateProducts(db *gorm.DB) error {
+	var count int64
+	tx := db.Model(&models.Product{}).Count(&count)
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	products := []models.Product{
+		{StoreProductId: "sentinel_dvpn_5000", Name: "5000 DVPN", Amount: 5000 * 1000000, Denom: "udvpn"},
+		{StoreProductId: "sentinel_dvpn_10000", Name: "10000 DVPN", Amount: 10000 * 1000000, Denom: "udvpn"},
+		{StoreProductId: "sentinel_dvpn_15000", Name: "15000 DVPN", Amount: 15000 * 1000000, Denom: "udvpn"},
+	}
+
+	tx = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&products)
+	return tx.Error
 }
 
 func GetDB() (*gorm.DB, error) {
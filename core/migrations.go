@@ -0,0 +1,88 @@
+package core
+
+import (
+	"dvpn/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WalletBackfills fills columns that were added to the wallets table after launch for the rows that
+// existed before them. It has to be planned before AutoMigrate, while the missing columns can still
+// be detected, and run after it.
+type WalletBackfills struct {
+	LastSeenAt             bool
+	PlanSubscriptionStatus bool
+}
+
+func PlanWalletBackfills(db *gorm.DB) WalletBackfills {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&models.Wallet{}) {
+		return WalletBackfills{}
+	}
+
+	return WalletBackfills{
+		LastSeenAt:             !migrator.HasColumn(&models.Wallet{}, "last_seen_at"),
+		PlanSubscriptionStatus: !migrator.HasColumn(&models.Wallet{}, "plan_subscription_status"),
+	}
+}
+
+func (b WalletBackfills) Run(db *gorm.DB) error {
+	// Existing wallets are treated as seen at deploy time, so they are neither revoked as inactive
+	// nor skipped by renewals before their apps check in again.
+	if b.LastSeenAt {
+		tx := db.Model(&models.Wallet{}).Where("last_seen_at IS NULL AND deregistered_at IS NULL").Update("last_seen_at", time.Now())
+		if tx.Error != nil {
+			return tx.Error
+		}
+	}
+
+	// Plan allocations are only made to wallets enrolled after they were introduced, instead of
+	// allocating bytes to the whole existing user base at once.
+	if b.PlanSubscriptionStatus {
+		tx := db.Model(&models.Wallet{}).Where("plan_subscription_status = ?", models.PlanSubscriptionStatusPending).Update("plan_subscription_status", models.PlanSubscriptionStatusNotEligible)
+		if tx.Error != nil {
+			return tx.Error
+		}
+	}
+
+	return nil
+}
+
+// HashTrialGrantAddresses replaces the plain subnet of trial grants, which was erased along with its
+// wallet, by hashes of the registration IP address and subnet that keep trials unique per network.
+// Where earlier grants share an IP address or subnet, only the first one is given its hash.
+func HashTrialGrantAddresses(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasColumn(&models.TrialGrant{}, "subnet") {
+		return nil
+	}
+
+	statements := []string{
+		`UPDATE trial_grants SET subnet_hash = encode(sha256(convert_to('trial-subnet:' || subnet::text, 'UTF8')), 'hex')
+			WHERE id IN (SELECT DISTINCT ON (subnet) id FROM trial_grants WHERE subnet IS NOT NULL ORDER BY subnet, id)`,
+		`UPDATE trial_grants SET ip_hash = encode(sha256(convert_to('trial-ip:' || host(w.registration_ip), 'UTF8')), 'hex')
+			FROM wallets w WHERE w.id = trial_grants.wallet_id
+			AND trial_grants.id IN (SELECT DISTINCT ON (w.registration_ip) g.id FROM trial_grants g JOIN wallets w ON w.id = g.wallet_id WHERE w.registration_ip IS NOT NULL ORDER BY w.registration_ip, g.id)`,
+	}
+
+	for _, statement := range statements {
+		err := db.Exec(statement).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return migrator.DropColumn(&models.TrialGrant{}, "subnet")
+}
+
+// DropServerRemoteIP drops the single remote IP column of servers, which was replaced by the
+// server_remote_ips table holding every address their remote host resolves to.
+func DropServerRemoteIP(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasColumn(&models.Server{}, "remote_ip") {
+		return nil
+	}
+
+	return migrator.DropColumn(&models.Server{}, "remote_ip")
+}
@@ -0,0 +1,71 @@
+package address
+
+import (
+	"dvpn/internal/bech32"
+	"errors"
+	"strings"
+)
+
+type Prefixes struct {
+	Account  string
+	Node     string
+	Provider string
+}
+
+func ParsePrefixes(account string, node string, provider string) Prefixes {
+	prefixes := Prefixes{
+		Account:  "sent",
+		Node:     "sentnode",
+		Provider: "sentprov",
+	}
+
+	if account != "" {
+		prefixes.Account = strings.ToLower(account)
+	}
+
+	if node != "" {
+		prefixes.Node = strings.ToLower(node)
+	}
+
+	if provider != "" {
+		prefixes.Provider = strings.ToLower(provider)
+	}
+
+	return prefixes
+}
+
+// Normalize decodes a bech32 address, verifies its checksum and human-readable part, and
+// returns it in canonical lowercase form.
+func Normalize(address string, hrp string) (string, error) {
+	address = strings.TrimSpace(address)
+	if address == "" {
+		return "", errors.New("empty address")
+	}
+
+	prefix, data, err := bech32.Decode(address)
+	if err != nil {
+		return "", err
+	}
+
+	if prefix != hrp {
+		return "", errors.New("unexpected address prefix " + prefix + ", expected " + hrp)
+	}
+
+	if len(data) != 20 && len(data) != 32 {
+		return "", errors.New("invalid address length")
+	}
+
+	return bech32.Encode(prefix, data)
+}
+
+func (p Prefixes) NormalizeAccount(address string) (string, error) {
+	return Normalize(address, p.Account)
+}
+
+func (p Prefixes) NormalizeNode(address string) (string, error) {
+	return Normalize(address, p.Node)
+}
+
+func (p Prefixes) NormalizeProvider(address string) (string, error) {
+	return Normalize(address, p.Provider)
+}
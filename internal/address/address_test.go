@@ -0,0 +1,99 @@
+package address
+
+import (
+	"bytes"
+	"dvpn/internal/bech32"
+	"strings"
+	"testing"
+)
+
+func encode(t *testing.T, hrp string, data []byte) string {
+	address, err := bech32.Encode(hrp, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return address
+}
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes := ParsePrefixes("", "", "")
+	if prefixes != (Prefixes{Account: "sent", Node: "sentnode", Provider: "sentprov"}) {
+		t.Errorf("ParsePrefixes() defaults = %+v", prefixes)
+	}
+
+	prefixes = ParsePrefixes("Cosmos", "COSMOSVALOPER", "cosmosprov")
+	if prefixes != (Prefixes{Account: "cosmos", Node: "cosmosvaloper", Provider: "cosmosprov"}) {
+		t.Errorf("ParsePrefixes() = %+v, want lowercase prefixes", prefixes)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	// The program of the first BIP-173 address.
+	const account = "sent1w508d6qejxtdg4y5r3zarvary0c5xw7kpxprth"
+
+	key := bytes.Repeat([]byte{0xab}, 32)
+	node := encode(t, "sentnode", key[:20])
+	provider := encode(t, "sentprov", key[:20])
+	long := encode(t, "sent", key)
+
+	tests := []struct {
+		name    string
+		address string
+		hrp     string
+		want    string
+	}{
+		{name: "account", address: account, hrp: "sent", want: account},
+		{name: "uppercase", address: strings.ToUpper(account), hrp: "sent", want: account},
+		{name: "surrounding whitespace", address: " " + account + "\n", hrp: "sent", want: account},
+		{name: "node", address: node, hrp: "sentnode", want: node},
+		{name: "provider", address: provider, hrp: "sentprov", want: provider},
+		{name: "32 byte payload", address: long, hrp: "sent", want: long},
+		{name: "mixed case", address: "sent1W508d6qejxtdg4y5r3zarvary0c5xw7kpxprth", hrp: "sent"},
+		{name: "bad checksum", address: "sent1w508d6qejxtdg4y5r3zarvary0c5xw7kpxprtj", hrp: "sent"},
+		{name: "other chain", address: "cosmos1w508d6qejxtdg4y5r3zarvary0c5xw7k6ah60c", hrp: "sent"},
+		{name: "node as account", address: node, hrp: "sent"},
+		{name: "account as provider", address: account, hrp: "sentprov"},
+		{name: "19 byte payload", address: encode(t, "sent", key[:19]), hrp: "sent"},
+		{name: "21 byte payload", address: encode(t, "sent", key[:21]), hrp: "sent"},
+		{name: "empty", address: " ", hrp: "sent"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			normalized, err := Normalize(test.address, test.hrp)
+			if test.want == "" {
+				if err == nil {
+					t.Fatalf("Normalize(%q, %q) = %q, want an error", test.address, test.hrp, normalized)
+				}
+
+				return
+			}
+
+			if err != nil || normalized != test.want {
+				t.Fatalf("Normalize(%q, %q) = %q, %v, want %q", test.address, test.hrp, normalized, err, test.want)
+			}
+		})
+	}
+}
+
+func TestPrefixesNormalize(t *testing.T) {
+	prefixes := ParsePrefixes("", "", "")
+	key := bytes.Repeat([]byte{0x01}, 20)
+
+	if _, err := prefixes.NormalizeAccount(encode(t, "sent", key)); err != nil {
+		t.Errorf("NormalizeAccount() error = %v", err)
+	}
+
+	if _, err := prefixes.NormalizeNode(encode(t, "sentnode", key)); err != nil {
+		t.Errorf("NormalizeNode() error = %v", err)
+	}
+
+	if _, err := prefixes.NormalizeProvider(encode(t, "sentprov", key)); err != nil {
+		t.Errorf("NormalizeProvider() error = %v", err)
+	}
+
+	if _, err := prefixes.NormalizeProvider(encode(t, "sentnode", key)); err == nil {
+		t.Error("NormalizeProvider() accepted a node address")
+	}
+}
@@ -0,0 +1,167 @@
+package aggregates
+
+import (
+	"dvpn/models"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Cache struct {
+	DB  *gorm.DB
+	TTL time.Duration
+
+	mu        sync.RWMutex
+	loadedAt  time.Time
+	countries map[uint]models.Country
+	cities    map[uint]models.City
+
+	countryAggregates []models.CountryAggregate
+	cityAggregates    []models.CityAggregate
+}
+
+func (c *Cache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.loadedAt = time.Time{}
+}
+
+func (c *Cache) Countries(protocols []string) ([]models.Country, error) {
+	err := c.refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	stats := make(map[uint][]models.AggregateStats)
+	for _, aggregate := range c.countryAggregates {
+		if contains(protocols, string(aggregate.Protocol)) {
+			stats[aggregate.CountryID] = append(stats[aggregate.CountryID], aggregate.AggregateStats)
+		}
+	}
+
+	countries := make([]models.Country, 0, len(stats))
+	for countryId, countryStats := range stats {
+		country, ok := c.countries[countryId]
+		if !ok {
+			continue
+		}
+
+		merged := models.MergeAggregateStats(countryStats)
+		country.ServersAvailable = int(merged.Servers)
+		country.Stats = &merged
+		countries = append(countries, country)
+	}
+
+	sort.Slice(countries, func(i, j int) bool {
+		return countries[i].Name < countries[j].Name
+	})
+
+	return countries, nil
+}
+
+func (c *Cache) Cities(countryId uint, protocols []string) ([]models.City, error) {
+	err := c.refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	stats := make(map[uint][]models.AggregateStats)
+	for _, aggregate := range c.cityAggregates {
+		if aggregate.CountryID == countryId && contains(protocols, string(aggregate.Protocol)) {
+			stats[aggregate.CityID] = append(stats[aggregate.CityID], aggregate.AggregateStats)
+		}
+	}
+
+	cities := make([]models.City, 0, len(stats))
+	for cityId, cityStats := range stats {
+		city, ok := c.cities[cityId]
+		if !ok {
+			continue
+		}
+
+		merged := models.MergeAggregateStats(cityStats)
+		city.ServersAvailable = int(merged.Servers)
+		city.Stats = &merged
+		cities = append(cities, city)
+	}
+
+	sort.Slice(cities, func(i, j int) bool {
+		return cities[i].ServersAvailable > cities[j].ServersAvailable
+	})
+
+	return cities, nil
+}
+
+func (c *Cache) refresh() error {
+	c.mu.RLock()
+	isFresh := !c.loadedAt.IsZero() && time.Since(c.loadedAt) < c.TTL
+	c.mu.RUnlock()
+
+	if isFresh {
+		return nil
+	}
+
+	var countryAggregates []models.CountryAggregate
+	tx := c.DB.Find(&countryAggregates)
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	var cityAggregates []models.CityAggregate
+	tx = c.DB.Find(&cityAggregates)
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	var countryList []models.Country
+	tx = c.DB.Where("id IN (SELECT country_id FROM country_aggregates)").Find(&countryList)
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	var cityList []models.City
+	tx = c.DB.Where("id IN (SELECT city_id FROM city_aggregates)").Find(&cityList)
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	countries := make(map[uint]models.Country)
+	for _, country := range countryList {
+		countries[country.ID] = country
+	}
+
+	cities := make(map[uint]models.City)
+	for _, city := range cityList {
+		cities[city.ID] = city
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.countries = countries
+	c.cities = cities
+	c.countryAggregates = countryAggregates
+	c.cityAggregates = cityAggregates
+	c.loadedAt = time.Now()
+
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
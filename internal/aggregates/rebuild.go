@@ -0,0 +1,53 @@
+package aggregates
+
+import (
+	"dvpn/models"
+
+	"gorm.io/gorm"
+)
+
+const statsColumns = "servers, average_load, best_download, best_upload, min_price_per_gb, max_price_per_gb, min_price_per_hour, max_price_per_hour"
+
+const statsSelect = `COUNT(s.id),
+	COALESCE(AVG(s.current_load), 0),
+	COALESCE(MAX((s.configuration->>'bandwidthDownload')::bigint), 0),
+	COALESCE(MAX((s.configuration->>'bandwidthUpload')::bigint), 0),
+	MIN(NULLIF((s.configuration->>'pricePerGB')::bigint, 0)),
+	MAX(NULLIF((s.configuration->>'pricePerGB')::bigint, 0)),
+	MIN(NULLIF((s.configuration->>'pricePerHour')::bigint, 0)),
+	MAX(NULLIF((s.configuration->>'pricePerHour')::bigint, 0))`
+
+// Rebuild replaces the country and city aggregates with the visible servers currently in the
+// database, recording them under the given catalog revision.
+func Rebuild(db *gorm.DB, revision int64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec("DELETE FROM country_aggregates").Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Exec("INSERT INTO country_aggregates (created_at, updated_at, country_id, protocol, revision, "+statsColumns+") SELECT NOW(), NOW(), s.country_id, s.protocol, ?, "+statsSelect+" FROM servers AS s WHERE s.is_active = true AND s.is_banned = false AND s.is_version_supported = true GROUP BY s.country_id, s.protocol", revision).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Exec("DELETE FROM city_aggregates").Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Exec("INSERT INTO city_aggregates (created_at, updated_at, city_id, country_id, protocol, revision, "+statsColumns+") SELECT NOW(), NOW(), s.city_id, s.country_id, s.protocol, ?, "+statsSelect+" FROM servers AS s WHERE s.is_active = true AND s.is_banned = false AND s.is_version_supported = true GROUP BY s.city_id, s.country_id, s.protocol", revision).Error
+	})
+}
+
+// RebuildLatest rebuilds the aggregates under the revision of the last node fetch, so they match
+// the servers in the database before the next fetch runs, or when fetches are disabled.
+func RebuildLatest(db *gorm.DB) error {
+	var revision int64
+	err := db.Model(&models.Server{}).Select("COALESCE(MAX(revision), 0)").Scan(&revision).Error
+	if err != nil {
+		return err
+	}
+
+	return Rebuild(db, revision)
+}
@@ -0,0 +1,203 @@
+package banpolicy
+
+import (
+	"dvpn/internal/versionpolicy"
+	"dvpn/models"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const BanSource = "policy"
+
+type Action string
+
+const (
+	ActionBan    Action = "BAN"
+	ActionExtend Action = "EXTEND"
+	ActionUnban  Action = "UNBAN"
+)
+
+type Change struct {
+	ServerID  uint       `json:"server_id"`
+	Address   string     `json:"address"`
+	Name      string     `json:"name"`
+	Action    Action     `json:"action"`
+	Reasons   []string   `json:"reasons"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type Engine struct {
+	DB       *gorm.DB
+	Logger   *zap.SugaredLogger
+	Rules    *Rules
+	Versions *versionpolicy.Policy
+}
+
+func (e Engine) Evaluate() ([]Change, error) {
+	changes, _, err := e.evaluate(time.Now())
+	return changes, err
+}
+
+func (e Engine) Apply() ([]Change, error) {
+	now := time.Now()
+
+	changes, overloaded, err := e.evaluate(now)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, change := range changes {
+		updates := map[string]interface{}{
+			"is_banned":      false,
+			"ban_reason":     nil,
+			"ban_source":     "",
+			"ban_expires_at": nil,
+		}
+
+		if change.Action != ActionUnban {
+			reason := strings.Join(change.Reasons, "; ")
+			updates["is_banned"] = true
+			updates["ban_reason"] = reason
+			updates["ban_source"] = BanSource
+			updates["ban_expires_at"] = change.ExpiresAt
+		}
+
+		tx := e.DB.Model(&models.Server{}).Where("id = ?", change.ServerID).Updates(updates)
+		if tx.Error != nil {
+			e.Logger.Errorf("failed to apply ban policy %s to server %s: %s", change.Action, change.Address, tx.Error)
+			continue
+		}
+
+		e.Logger.Infof("ban policy %s for server %s: %s", change.Action, change.Address, strings.Join(change.Reasons, "; "))
+	}
+
+	tx := e.DB.Model(&models.Server{}).Where("overloaded_since IS NULL AND id IN ?", append(overloaded, 0)).Update("overloaded_since", now)
+	if tx.Error != nil {
+		e.Logger.Errorf("failed to mark overloaded servers: %s", tx.Error)
+	}
+
+	tx = e.DB.Model(&models.Server{}).Where("overloaded_since IS NOT NULL AND id NOT IN ?", append(overloaded, 0)).Update("overloaded_since", nil)
+	if tx.Error != nil {
+		e.Logger.Errorf("failed to clear overloaded servers: %s", tx.Error)
+	}
+
+	return changes, nil
+}
+
+func (e Engine) evaluate(now time.Time) ([]Change, []uint, error) {
+	var servers []models.Server
+	tx := e.DB.Model(&models.Server{}).Preload("Reliability").Where("is_active = ? OR ban_source = ?", true, BanSource).Find(&servers)
+	if tx.Error != nil {
+		return nil, nil, tx.Error
+	}
+
+	var patterns []*regexp.Regexp
+	for _, pattern := range e.Rules.MonikerPatterns {
+		patterns = append(patterns, regexp.MustCompile(pattern))
+	}
+
+	var changes []Change
+	var overloaded []uint
+
+	for _, server := range servers {
+		if e.Rules.MaxLoad != nil && server.CurrentLoad >= *e.Rules.MaxLoad {
+			overloaded = append(overloaded, server.ID)
+		}
+
+		if server.IsBanned && server.BanSource != BanSource {
+			continue
+		}
+
+		reasons := e.match(server, patterns, now)
+		isExpired := server.BanExpiresAt == nil || !server.BanExpiresAt.After(now)
+
+		change := Change{
+			ServerID: server.ID,
+			Address:  server.Address,
+			Name:     server.Name,
+			Reasons:  reasons,
+		}
+
+		if len(reasons) > 0 {
+			expiresAt := now.Add(time.Duration(e.Rules.BanDuration))
+			change.ExpiresAt = &expiresAt
+
+			if !server.IsBanned {
+				change.Action = ActionBan
+			} else if isExpired {
+				change.Action = ActionExtend
+			} else {
+				continue
+			}
+		} else {
+			if !server.IsBanned || !isExpired {
+				continue
+			}
+
+			change.Action = ActionUnban
+			change.Reasons = []string{"no ban policy rule matches anymore"}
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes, overloaded, nil
+}
+
+func (e Engine) match(server models.Server, patterns []*regexp.Regexp, now time.Time) []string {
+	var reasons []string
+
+	configuration := server.Configuration.Data()
+
+	if e.Rules.BanUnsupportedVersions && e.Versions != nil {
+		if supported, reason := e.Versions.IsSupported(server.Protocol, configuration.Version); !supported {
+			reasons = append(reasons, reason+" for "+string(server.Protocol))
+		}
+	}
+
+	for _, asn := range e.Rules.BlockedASNs {
+		if configuration.ASN != "" && normalizeASN(configuration.ASN) == normalizeASN(asn) {
+			reasons = append(reasons, "ASN "+configuration.ASN+" is blocked")
+		}
+	}
+
+	for _, operator := range e.Rules.BlockedOperators {
+		if configuration.Operator != "" && strings.EqualFold(configuration.Operator, operator) {
+			reasons = append(reasons, "operator "+configuration.Operator+" is blocked")
+		}
+	}
+
+	if e.Rules.BanZeroBandwidth && (configuration.BandwidthDownload == 0 || configuration.BandwidthUpload == 0) {
+		reasons = append(reasons, "zero bandwidth reported")
+	}
+
+	if e.Rules.MaxFailureRate != nil && server.Reliability != nil && server.Reliability.Reports >= e.Rules.MinReports {
+		failureRate := 1 - server.Reliability.SuccessRate
+		if failureRate > *e.Rules.MaxFailureRate {
+			reasons = append(reasons, fmt.Sprintf("failure rate %.2f over %d reports exceeds %.2f", failureRate, server.Reliability.Reports, *e.Rules.MaxFailureRate))
+		}
+	}
+
+	if e.Rules.MaxLoad != nil && server.CurrentLoad >= *e.Rules.MaxLoad && server.OverloadedSince != nil {
+		overloadedFor := now.Sub(*server.OverloadedSince)
+		if overloadedFor >= time.Duration(e.Rules.MaxLoadDuration) {
+			reasons = append(reasons, fmt.Sprintf("load %.2f has exceeded %.2f for %s", server.CurrentLoad, *e.Rules.MaxLoad, overloadedFor.Round(time.Minute)))
+		}
+	}
+
+	for _, pattern := range patterns {
+		if pattern.MatchString(server.Name) {
+			reasons = append(reasons, "moniker matches "+pattern.String())
+		}
+	}
+
+	return reasons
+}
+
+func normalizeASN(asn string) string {
+	return strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(asn)), "AS")
+}
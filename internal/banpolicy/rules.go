@@ -0,0 +1,83 @@
+package banpolicy
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"regexp"
+	"time"
+)
+
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+type Rules struct {
+	// BanUnsupportedVersions bans servers rejected by the node version policy, whose minimum and
+	// blocked versions are configured with NODE_MIN_VERSION_<PROTOCOL> and NODE_BLOCKED_VERSIONS_<PROTOCOL>.
+	BanUnsupportedVersions bool     `json:"ban_unsupported_versions"`
+	BlockedASNs            []string `json:"blocked_asns"`
+	BlockedOperators       []string `json:"blocked_operators"`
+	MonikerPatterns        []string `json:"moniker_patterns"`
+	BanZeroBandwidth       bool     `json:"ban_zero_bandwidth"`
+
+	MaxFailureRate *float64 `json:"max_failure_rate"`
+	MinReports     int64    `json:"min_reports"`
+
+	MaxLoad         *float64 `json:"max_load"`
+	MaxLoadDuration Duration `json:"max_load_duration"`
+
+	BanDuration Duration `json:"ban_duration"`
+}
+
+func LoadRules(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules Rules
+	err = json.Unmarshal(data, &rules)
+	if err != nil {
+		return nil, errors.New("failed to parse ban policy " + path + ": " + err.Error())
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, errors.New("failed to parse ban policy " + path + ": " + err.Error())
+	}
+
+	if _, ok := fields["min_versions"]; ok {
+		return nil, errors.New("ban policy " + path + " must not define min_versions, set NODE_MIN_VERSION_<PROTOCOL> and ban_unsupported_versions instead")
+	}
+
+	if rules.BanDuration <= 0 {
+		return nil, errors.New("ban policy " + path + " must define a positive ban_duration")
+	}
+
+	for _, pattern := range rules.MonikerPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, errors.New("invalid moniker pattern " + pattern + ": " + err.Error())
+		}
+	}
+
+	return &rules, nil
+}
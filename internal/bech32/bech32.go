@@ -0,0 +1,150 @@
+package bech32
+
+import (
+	"errors"
+	"strings"
+)
+
+const charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+var generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+func Encode(hrp string, data []byte) (string, error) {
+	values, err := ConvertBits(data, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+
+	hrp = strings.ToLower(hrp)
+	checksum := createChecksum(hrp, values)
+
+	var result strings.Builder
+	result.WriteString(hrp)
+	result.WriteByte('1')
+	for _, value := range append(values, checksum...) {
+		result.WriteByte(charset[value])
+	}
+
+	return result.String(), nil
+}
+
+func Decode(address string) (string, []byte, error) {
+	if len(address) < 8 || len(address) > 90 {
+		return "", nil, errors.New("invalid bech32 string length")
+	}
+
+	if strings.ToLower(address) != address && strings.ToUpper(address) != address {
+		return "", nil, errors.New("mixed case bech32 string")
+	}
+
+	address = strings.ToLower(address)
+
+	separator := strings.LastIndexByte(address, '1')
+	if separator < 1 || separator+7 > len(address) {
+		return "", nil, errors.New("invalid bech32 separator position")
+	}
+
+	hrp := address[:separator]
+	for _, r := range hrp {
+		if r < 33 || r > 126 {
+			return "", nil, errors.New("invalid bech32 human-readable part")
+		}
+	}
+
+	var values []byte
+	for _, r := range address[separator+1:] {
+		index := strings.IndexRune(charset, r)
+		if index == -1 {
+			return "", nil, errors.New("invalid bech32 character " + string(r))
+		}
+
+		values = append(values, byte(index))
+	}
+
+	if polymod(append(expandHRP(hrp), values...)) != 1 {
+		return "", nil, errors.New("invalid bech32 checksum")
+	}
+
+	data, err := ConvertBits(values[:len(values)-6], 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return hrp, data, nil
+}
+
+func ConvertBits(data []byte, fromBits uint, toBits uint, pad bool) ([]byte, error) {
+	var result []byte
+	var accumulator uint32
+	var bits uint
+
+	maxValue := uint32(1<<toBits) - 1
+
+	for _, value := range data {
+		if uint32(value)>>fromBits != 0 {
+			return nil, errors.New("invalid data range")
+		}
+
+		accumulator = accumulator<<fromBits | uint32(value)
+		bits += fromBits
+
+		for bits >= toBits {
+			bits -= toBits
+			result = append(result, byte(accumulator>>bits&maxValue))
+		}
+	}
+
+	if pad {
+		if bits > 0 {
+			result = append(result, byte(accumulator<<(toBits-bits)&maxValue))
+		}
+	} else if bits >= fromBits || accumulator<<(toBits-bits)&maxValue != 0 {
+		return nil, errors.New("invalid padding")
+	}
+
+	return result, nil
+}
+
+func polymod(values []byte) uint32 {
+	checksum := uint32(1)
+
+	for _, value := range values {
+		top := checksum >> 25
+		checksum = (checksum&0x1ffffff)<<5 ^ uint32(value)
+
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				checksum ^= generator[i]
+			}
+		}
+	}
+
+	return checksum
+}
+
+func expandHRP(hrp string) []byte {
+	result := make([]byte, 0, len(hrp)*2+1)
+
+	for i := 0; i < len(hrp); i++ {
+		result = append(result, hrp[i]>>5)
+	}
+
+	result = append(result, 0)
+
+	for i := 0; i < len(hrp); i++ {
+		result = append(result, hrp[i]&31)
+	}
+
+	return result
+}
+
+func createChecksum(hrp string, values []byte) []byte {
+	mod := polymod(append(append(expandHRP(hrp), values...), 0, 0, 0, 0, 0, 0)) ^ 1
+
+	checksum := make([]byte, 6)
+	for i := 0; i < 6; i++ {
+		checksum[i] = byte(mod >> uint(5*(5-i)) & 31)
+	}
+
+	return checksum
+}
@@ -0,0 +1,88 @@
+package bech32
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestDecodeValid(t *testing.T) {
+	// Valid strings from BIP-173.
+	tests := []string{
+		"A12UEL5L",
+		"a12uel5l",
+		"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+		"11qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqc8247j",
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+	}
+
+	for _, test := range tests {
+		hrp, data, err := Decode(test)
+		if err != nil {
+			t.Errorf("Decode(%q) failed: %s", test, err)
+			continue
+		}
+
+		encoded, err := Encode(hrp, data)
+		if err != nil {
+			t.Errorf("Encode(%q) failed: %s", hrp, err)
+			continue
+		}
+
+		if encoded != strings.ToLower(test) {
+			t.Errorf("Encode(Decode(%q)) = %q", test, encoded)
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	tests := []struct {
+		input  string
+		reason string
+	}{
+		{"pzry9x0s0muk", "no separator"},
+		{"1pzry9x0s0muk", "empty human-readable part"},
+		{"x1b4n0q5v", "invalid data character"},
+		{"li1dgmt3", "checksum too short"},
+		{"A1G7SGD8", "checksum computed with uppercase human-readable part"},
+		{"10a06t8", "empty human-readable part"},
+		{"1qzzfhee", "empty human-readable part"},
+		{"a12UEL5L", "mixed case"},
+		{"an84characterslonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1569pvx", "too long"},
+		{"sent1w508d6qejxtdg4y5r3zarvary0c5xw7kpxprtj", "invalid checksum"},
+	}
+
+	for _, test := range tests {
+		_, _, err := Decode(test.input)
+		if err == nil {
+			t.Errorf("Decode(%q) succeeded, want error for %s", test.input, test.reason)
+		}
+	}
+}
+
+func TestAccountAddresses(t *testing.T) {
+	// The HASH160 of the compressed secp256k1 generator point, the program of the first BIP-173
+	// example address.
+	data, _ := hex.DecodeString("751e76e8199196d454941c45d1b3a323f1433bd6")
+
+	tests := []struct {
+		hrp     string
+		address string
+	}{
+		{"cosmos", "cosmos1w508d6qejxtdg4y5r3zarvary0c5xw7k6ah60c"},
+		{"sent", "sent1w508d6qejxtdg4y5r3zarvary0c5xw7kpxprth"},
+	}
+
+	for _, test := range tests {
+		address, err := Encode(test.hrp, data)
+		if err != nil || address != test.address {
+			t.Errorf("Encode(%q) = %q, %v, want %q", test.hrp, address, err, test.address)
+		}
+
+		hrp, decoded, err := Decode(test.address)
+		if err != nil || hrp != test.hrp || hex.EncodeToString(decoded) != hex.EncodeToString(data) {
+			t.Errorf("Decode(%q) = %q, %x, %v", test.address, hrp, decoded, err)
+		}
+	}
+}
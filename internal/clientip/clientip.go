@@ -0,0 +1,176 @@
+package clientip
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type Resolver struct {
+	TrustedProxies []*net.IPNet
+}
+
+func ParseTrustedProxies(value string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		if !strings.Contains(part, "/") {
+			ip := net.ParseIP(part)
+			if ip == nil {
+				return nil, errors.New("invalid trusted proxy address " + part)
+			}
+
+			if ip.To4() != nil {
+				part += "/32"
+			} else {
+				part += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(part)
+		if err != nil {
+			return nil, err
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+func (r Resolver) ClientIP(req *http.Request) (net.IP, error) {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(req.RemoteAddr))
+	if err != nil {
+		host = req.RemoteAddr
+	}
+
+	remoteIp := net.ParseIP(host)
+	if remoteIp == nil {
+		return nil, errors.New("failed to parse remote address " + req.RemoteAddr)
+	}
+
+	if !r.isTrusted(remoteIp) {
+		return remoteIp, nil
+	}
+
+	realIp := net.ParseIP(strings.TrimSpace(req.Header.Get("CF-Connecting-IP")))
+	if realIp != nil {
+		return realIp, nil
+	}
+
+	var chain []string
+
+	forwarded := req.Header.Values("Forwarded")
+	if len(forwarded) > 0 {
+		chain = parseForwarded(forwarded)
+	} else {
+		for _, value := range req.Header.Values("X-Forwarded-For") {
+			chain = append(chain, strings.Split(value, ",")...)
+		}
+	}
+
+	clientIp := remoteIp
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := parseNode(chain[i])
+		if ip == nil {
+			break
+		}
+
+		clientIp = ip
+		if !r.isTrusted(ip) {
+			break
+		}
+	}
+
+	return clientIp, nil
+}
+
+func (r Resolver) isTrusted(ip net.IP) bool {
+	for _, network := range r.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseForwarded returns the "for" parameters of RFC 7239 Forwarded headers, in hop order.
+func parseForwarded(values []string) []string {
+	var nodes []string
+
+	for _, value := range values {
+		for _, element := range splitQuoted(value, ',') {
+			for _, pair := range splitQuoted(element, ';') {
+				key, val, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if !found || !strings.EqualFold(key, "for") {
+					continue
+				}
+
+				nodes = append(nodes, strings.Trim(val, `"`))
+			}
+		}
+	}
+
+	return nodes
+}
+
+func splitQuoted(value string, separator rune) []string {
+	var parts []string
+	var quoted bool
+	start := 0
+
+	for i, r := range value {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == separator && !quoted:
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, value[start:])
+}
+
+func parseNode(node string) net.IP {
+	node = strings.TrimSpace(node)
+
+	if strings.HasPrefix(node, "[") {
+		end := strings.Index(node, "]")
+		if end == -1 {
+			return nil
+		}
+
+		return net.ParseIP(node[1:end])
+	}
+
+	if ip := net.ParseIP(node); ip != nil {
+		return ip
+	}
+
+	host, _, err := net.SplitHostPort(node)
+	if err != nil {
+		return nil
+	}
+
+	return net.ParseIP(host)
+}
+
+// Subnet returns the /24 (IPv4) or /48 (IPv6) network an address belongs to, the usual
+// allocation unit for a single customer.
+func Subnet(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		mask := net.CIDRMask(24, 32)
+		return &net.IPNet{IP: ip4.Mask(mask), Mask: mask}
+	}
+
+	mask := net.CIDRMask(48, 128)
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+}
@@ -0,0 +1,164 @@
+package feegrant
+
+import (
+	"dvpn/internal/sentinel"
+	"encoding/json"
+	"errors"
+	"os"
+	"regexp"
+	"time"
+)
+
+const (
+	AllowanceTypeBasic    = "BASIC"
+	AllowanceTypePeriodic = "PERIODIC"
+)
+
+const (
+	TierFree = "FREE"
+	TierPaid = "PAID"
+)
+
+const DefaultPolicyName = "default"
+
+var coinsPattern = regexp.MustCompile(`^[0-9]+[a-zA-Z][a-zA-Z0-9/:._-]{2,127}(,[0-9]+[a-zA-Z][a-zA-Z0-9/:._-]{2,127})*$`)
+
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+type Policy struct {
+	Type             string   `json:"type"`
+	SpendLimit       string   `json:"spend_limit"`
+	Period           Duration `json:"period"`
+	PeriodSpendLimit string   `json:"period_spend_limit"`
+	Expiration       Duration `json:"expiration"`
+}
+
+type Policies struct {
+	Policies map[string]Policy `json:"policies"`
+	Tiers    map[string]string `json:"tiers"`
+}
+
+// DefaultPolicies grants every tier an unlimited basic allowance without expiration.
+func DefaultPolicies() *Policies {
+	return &Policies{
+		Policies: map[string]Policy{
+			DefaultPolicyName: {Type: AllowanceTypeBasic},
+		},
+		Tiers: map[string]string{
+			TierFree: DefaultPolicyName,
+			TierPaid: DefaultPolicyName,
+		},
+	}
+}
+
+func LoadPolicies(path string) (*Policies, error) {
+	if path == "" {
+		return DefaultPolicies(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var policies Policies
+	err = json.Unmarshal(data, &policies)
+	if err != nil {
+		return nil, errors.New("failed to parse fee grant policies " + path + ": " + err.Error())
+	}
+
+	for name, policy := range policies.Policies {
+		err = policy.validate()
+		if err != nil {
+			return nil, errors.New("invalid fee grant policy " + name + ": " + err.Error())
+		}
+	}
+
+	for _, tier := range []string{TierFree, TierPaid} {
+		name, ok := policies.Tiers[tier]
+		if !ok {
+			return nil, errors.New("fee grant policies " + path + " must define a policy for tier " + tier)
+		}
+
+		if _, ok := policies.Policies[name]; !ok {
+			return nil, errors.New("tier " + tier + " refers to unknown fee grant policy " + name)
+		}
+	}
+
+	return &policies, nil
+}
+
+func (p Policies) ForTier(tier string) (string, Policy) {
+	name, ok := p.Tiers[tier]
+	if !ok {
+		name = p.Tiers[TierFree]
+	}
+
+	return name, p.Policies[name]
+}
+
+func (p Policy) Allowance(now time.Time) sentinel.FeeAllowance {
+	allowance := sentinel.FeeAllowance{
+		SpendLimit: p.SpendLimit,
+	}
+
+	if p.Expiration > 0 {
+		expiration := now.Add(time.Duration(p.Expiration)).UTC()
+		allowance.Expiration = &expiration
+	}
+
+	if p.Type == AllowanceTypePeriodic {
+		allowance.Period = int64(time.Duration(p.Period).Seconds())
+		allowance.PeriodSpendLimit = p.PeriodSpendLimit
+	}
+
+	return allowance
+}
+
+func (p Policy) validate() error {
+	if p.SpendLimit != "" && !coinsPattern.MatchString(p.SpendLimit) {
+		return errors.New("invalid spend_limit " + p.SpendLimit)
+	}
+
+	if p.Expiration < 0 {
+		return errors.New("expiration must not be negative")
+	}
+
+	switch p.Type {
+	case AllowanceTypeBasic:
+		if p.Period != 0 || p.PeriodSpendLimit != "" {
+			return errors.New("period and period_spend_limit are only allowed for " + AllowanceTypePeriodic + " allowances")
+		}
+	case AllowanceTypePeriodic:
+		if p.Period <= 0 {
+			return errors.New("periodic allowance must define a positive period")
+		}
+
+		if !coinsPattern.MatchString(p.PeriodSpendLimit) {
+			return errors.New("invalid period_spend_limit " + p.PeriodSpendLimit)
+		}
+	default:
+		return errors.New("unsupported allowance type " + p.Type)
+	}
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package feegrant
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Policy
+		wantErr string
+	}{
+		{name: "unlimited basic", policy: Policy{Type: AllowanceTypeBasic}},
+		{name: "basic with spend limit and expiration", policy: Policy{Type: AllowanceTypeBasic, SpendLimit: "1000000udvpn", Expiration: Duration(720 * time.Hour)}},
+		{name: "multiple coins", policy: Policy{Type: AllowanceTypeBasic, SpendLimit: "1000000udvpn,5ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2"}},
+		{name: "periodic", policy: Policy{Type: AllowanceTypePeriodic, SpendLimit: "10000000udvpn", Period: Duration(24 * time.Hour), PeriodSpendLimit: "1000000udvpn"}},
+		{name: "periodic without total limit", policy: Policy{Type: AllowanceTypePeriodic, Period: Duration(time.Hour), PeriodSpendLimit: "1000udvpn"}},
+		{name: "missing type", policy: Policy{}, wantErr: "unsupported allowance type"},
+		{name: "lowercase type", policy: Policy{Type: "basic"}, wantErr: "unsupported allowance type"},
+		{name: "unknown type", policy: Policy{Type: "DELAYED"}, wantErr: "unsupported allowance type"},
+		{name: "spend limit without denom", policy: Policy{Type: AllowanceTypeBasic, SpendLimit: "1000000"}, wantErr: "invalid spend_limit"},
+		{name: "spend limit without amount", policy: Policy{Type: AllowanceTypeBasic, SpendLimit: "udvpn"}, wantErr: "invalid spend_limit"},
+		{name: "negative spend limit", policy: Policy{Type: AllowanceTypeBasic, SpendLimit: "-5udvpn"}, wantErr: "invalid spend_limit"},
+		{name: "spaced coins", policy: Policy{Type: AllowanceTypeBasic, SpendLimit: "5udvpn, 6uatom"}, wantErr: "invalid spend_limit"},
+		{name: "negative expiration", policy: Policy{Type: AllowanceTypeBasic, Expiration: Duration(-time.Hour)}, wantErr: "expiration must not be negative"},
+		{name: "basic with period", policy: Policy{Type: AllowanceTypeBasic, Period: Duration(time.Hour)}, wantErr: "only allowed for PERIODIC"},
+		{name: "basic with period spend limit", policy: Policy{Type: AllowanceTypeBasic, PeriodSpendLimit: "1udvpn"}, wantErr: "only allowed for PERIODIC"},
+		{name: "periodic without period", policy: Policy{Type: AllowanceTypePeriodic, PeriodSpendLimit: "1000udvpn"}, wantErr: "positive period"},
+		{name: "periodic with negative period", policy: Policy{Type: AllowanceTypePeriodic, Period: Duration(-time.Hour), PeriodSpendLimit: "1000udvpn"}, wantErr: "positive period"},
+		{name: "periodic without period spend limit", policy: Policy{Type: AllowanceTypePeriodic, Period: Duration(time.Hour)}, wantErr: "invalid period_spend_limit"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.policy.validate()
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validate() error = %v", err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("validate() error = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadPolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			data: `{"policies": {"free": {"type": "PERIODIC", "period": "24h", "period_spend_limit": "1000udvpn", "expiration": "720h"}, "paid": {"type": "BASIC"}}, "tiers": {"FREE": "free", "PAID": "paid"}}`,
+		},
+		{
+			name:    "invalid policy",
+			data:    `{"policies": {"free": {"type": "PERIODIC"}}, "tiers": {"FREE": "free", "PAID": "free"}}`,
+			wantErr: "invalid fee grant policy free",
+		},
+		{
+			name:    "invalid duration",
+			data:    `{"policies": {"free": {"type": "BASIC", "expiration": "30 days"}}, "tiers": {"FREE": "free", "PAID": "free"}}`,
+			wantErr: "failed to parse fee grant policies",
+		},
+		{
+			name:    "missing tier",
+			data:    `{"policies": {"free": {"type": "BASIC"}}, "tiers": {"FREE": "free"}}`,
+			wantErr: "must define a policy for tier PAID",
+		},
+		{
+			name:    "unknown policy",
+			data:    `{"policies": {"free": {"type": "BASIC"}}, "tiers": {"FREE": "free", "PAID": "paid"}}`,
+			wantErr: "tier PAID refers to unknown fee grant policy paid",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policies.json")
+			err := os.WriteFile(path, []byte(test.data), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			policies, err := LoadPolicies(path)
+			if test.wantErr == "" {
+				if err != nil || policies == nil {
+					t.Fatalf("LoadPolicies() error = %v", err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("LoadPolicies() error = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadDefaultPolicies(t *testing.T) {
+	policies, err := LoadPolicies("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tier := range []string{TierFree, TierPaid} {
+		name, policy := policies.ForTier(tier)
+		if name != DefaultPolicyName || policy.validate() != nil {
+			t.Errorf("ForTier(%s) = %s, %+v, want a valid default policy", tier, name, policy)
+		}
+	}
+}
+
+func TestPolicyAllowance(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	basic := Policy{Type: AllowanceTypeBasic, SpendLimit: "5udvpn", Period: Duration(time.Hour), PeriodSpendLimit: "1udvpn"}
+	allowance := basic.Allowance(now)
+	if allowance.SpendLimit != "5udvpn" || allowance.Expiration != nil || allowance.Period != 0 || allowance.PeriodSpendLimit != "" {
+		t.Errorf("basic Allowance() = %+v", allowance)
+	}
+
+	periodic := Policy{Type: AllowanceTypePeriodic, Period: Duration(24 * time.Hour), PeriodSpendLimit: "1udvpn", Expiration: Duration(48 * time.Hour)}
+	allowance = periodic.Allowance(now)
+	if allowance.Period != 86400 || allowance.PeriodSpendLimit != "1udvpn" || allowance.Expiration == nil || !allowance.Expiration.Equal(now.Add(48*time.Hour)) {
+		t.Errorf("periodic Allowance() = %+v", allowance)
+	}
+}
+
+func TestPoliciesForTier(t *testing.T) {
+	policies := Policies{
+		Policies: map[string]Policy{"free": {Type: AllowanceTypeBasic}, "paid": {Type: AllowanceTypeBasic, SpendLimit: "5udvpn"}},
+		Tiers:    map[string]string{TierFree: "free", TierPaid: "paid"},
+	}
+
+	tests := []struct {
+		tier string
+		want string
+	}{
+		{tier: TierFree, want: "free"},
+		{tier: TierPaid, want: "paid"},
+		{tier: "", want: "free"},
+		{tier: "ENTERPRISE", want: "free"},
+	}
+
+	for _, test := range tests {
+		if name, _ := policies.ForTier(test.tier); name != test.want {
+			t.Errorf("ForTier(%q) = %s, want %s", test.tier, name, test.want)
+		}
+	}
+}
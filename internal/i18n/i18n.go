@@ -0,0 +1,87 @@
+package i18n
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+const DefaultLanguages = "en,ar,de,es,fa,fr,hi,id,it,ja,ko,nl,pl,pt,ru,tr,uk,vi,zh-Hans,zh-Hant"
+
+type Localizer struct {
+	Languages []language.Tag
+	matcher   language.Matcher
+}
+
+func ParseLanguages(value string) ([]language.Tag, error) {
+	if strings.TrimSpace(value) == "" {
+		value = DefaultLanguages
+	}
+
+	languages := []language.Tag{language.English}
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		tag, err := language.Parse(part)
+		if err != nil {
+			return nil, errors.New("invalid language " + part + ": " + err.Error())
+		}
+
+		if tag != language.English {
+			languages = append(languages, tag)
+		}
+	}
+
+	return languages, nil
+}
+
+func NewLocalizer(languages []language.Tag) *Localizer {
+	return &Localizer{
+		Languages: languages,
+		matcher:   language.NewMatcher(languages),
+	}
+}
+
+func (l *Localizer) Negotiate(acceptLanguage string) language.Tag {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return language.English
+	}
+
+	_, index, confidence := l.matcher.Match(tags...)
+	if confidence == language.No {
+		return language.English
+	}
+
+	return l.Languages[index]
+}
+
+func CountryName(tag language.Tag, code string) (string, bool) {
+	region, err := language.ParseRegion(code)
+	if err != nil {
+		return "", false
+	}
+
+	namer := display.Regions(tag)
+	if namer == nil {
+		return "", false
+	}
+
+	name := namer.Name(region)
+	if name == "" {
+		return "", false
+	}
+
+	return name, true
+}
+
+func Collator(tag language.Tag) *collate.Collator {
+	return collate.New(tag)
+}
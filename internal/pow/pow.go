@@ -0,0 +1,145 @@
+package pow
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"time"
+)
+
+const (
+	randomSize    = 16
+	macSize       = 16
+	challengeSize = 8 + 1 + randomSize + macSize
+)
+
+// Issuer hands out stateless challenges: the expiry and difficulty are embedded in the challenge
+// and authenticated with an HMAC, so only challenges issued by this service are accepted.
+type Issuer struct {
+	Secret     []byte
+	Difficulty int
+	TTL        time.Duration
+}
+
+var (
+	ErrMalformed        = errors.New("malformed challenge")
+	ErrUnknown          = errors.New("unknown challenge")
+	ErrExpired          = errors.New("expired challenge")
+	ErrInsufficientWork = errors.New("insufficient proof of work")
+	ErrReused           = errors.New("challenge already used")
+)
+
+// Registry records the challenges that were redeemed, so each one is only accepted once.
+type Registry interface {
+	// Claim records the challenge as redeemed until expiresAt. It returns false if the challenge
+	// was redeemed before.
+	Claim(challenge string, expiresAt time.Time) (bool, error)
+}
+
+type Challenge struct {
+	Challenge  string    `json:"challenge"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+func (i Issuer) Issue() (*Challenge, error) {
+	expiresAt := time.Now().Add(i.TTL).UTC().Truncate(time.Second)
+
+	data := make([]byte, challengeSize)
+	binary.BigEndian.PutUint64(data[:8], uint64(expiresAt.Unix()))
+	data[8] = byte(i.Difficulty)
+
+	_, err := rand.Read(data[9 : 9+randomSize])
+	if err != nil {
+		return nil, err
+	}
+
+	copy(data[9+randomSize:], i.mac(data[:9+randomSize]))
+
+	return &Challenge{
+		Challenge:  base64.RawURLEncoding.EncodeToString(data),
+		Difficulty: i.Difficulty,
+		ExpiresAt:  expiresAt,
+	}, nil
+}
+
+// Verify checks that the challenge was issued by this service and has not expired, and that
+// SHA-256("<challenge>:<address>:<nonce>") starts with at least the embedded number of zero bits.
+func (i Issuer) Verify(challenge string, address string, nonce string) (time.Time, error) {
+	data, err := base64.RawURLEncoding.DecodeString(challenge)
+	if err != nil || len(data) != challengeSize {
+		return time.Time{}, ErrMalformed
+	}
+
+	if !hmac.Equal(data[9+randomSize:], i.mac(data[:9+randomSize])) {
+		return time.Time{}, ErrUnknown
+	}
+
+	expiresAt := time.Unix(int64(binary.BigEndian.Uint64(data[:8])), 0)
+	if time.Now().After(expiresAt) {
+		return time.Time{}, ErrExpired
+	}
+
+	hash := sha256.Sum256([]byte(challenge + ":" + address + ":" + nonce))
+	if leadingZeroBits(hash[:]) < int(data[8]) {
+		return time.Time{}, ErrInsufficientWork
+	}
+
+	return expiresAt, nil
+}
+
+// Redeem verifies the solution of a challenge and claims the challenge in the registry, so it
+// cannot be redeemed again.
+func (i Issuer) Redeem(registry Registry, challenge string, address string, nonce string) error {
+	expiresAt, err := i.Verify(challenge, address, nonce)
+	if err != nil {
+		return err
+	}
+
+	claimed, err := registry.Claim(challenge, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	if !claimed {
+		return ErrReused
+	}
+
+	return nil
+}
+
+// IsRejection reports whether err rejects the solution of a challenge, as opposed to failing to
+// record it.
+func IsRejection(err error) bool {
+	for _, rejection := range []error{ErrMalformed, ErrUnknown, ErrExpired, ErrInsufficientWork, ErrReused} {
+		if errors.Is(err, rejection) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (i Issuer) mac(data []byte) []byte {
+	hasher := hmac.New(sha256.New, i.Secret)
+	hasher.Write(data)
+
+	return hasher.Sum(nil)[:macSize]
+}
+
+func leadingZeroBits(data []byte) int {
+	count := 0
+	for _, b := range data {
+		if b != 0 {
+			return count + bits.LeadingZeros8(b)
+		}
+
+		count += 8
+	}
+
+	return count
+}
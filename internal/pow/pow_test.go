@@ -0,0 +1,212 @@
+package pow
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type memoryRegistry map[string]bool
+
+func (r memoryRegistry) Claim(challenge string, expiresAt time.Time) (bool, error) {
+	if r[challenge] {
+		return false, nil
+	}
+
+	r[challenge] = true
+	return true, nil
+}
+
+type failingRegistry struct{}
+
+func (failingRegistry) Claim(challenge string, expiresAt time.Time) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+// solve finds the first nonce whose hash has the embedded number of leading zero bits.
+func solve(t *testing.T, challenge string, address string, difficulty int) string {
+	for i := 0; i < 1<<24; i++ {
+		nonce := strconv.Itoa(i)
+		hash := sha256.Sum256([]byte(challenge + ":" + address + ":" + nonce))
+		if leadingZeroBits(hash[:]) >= difficulty {
+			return nonce
+		}
+	}
+
+	t.Fatal("no nonce found")
+	return ""
+}
+
+// unsolved finds a nonce whose hash has fewer leading zero bits than the difficulty.
+func unsolved(t *testing.T, challenge string, address string, difficulty int) string {
+	for i := 0; i < 1000; i++ {
+		nonce := strconv.Itoa(i)
+		hash := sha256.Sum256([]byte(challenge + ":" + address + ":" + nonce))
+		if leadingZeroBits(hash[:]) < difficulty {
+			return nonce
+		}
+	}
+
+	t.Fatal("no nonce found")
+	return ""
+}
+
+// forge builds a challenge with the given expiry and difficulty, authenticated with secret.
+func forge(secret []byte, expiresAt time.Time, difficulty int) string {
+	data := make([]byte, challengeSize)
+	binary.BigEndian.PutUint64(data[:8], uint64(expiresAt.Unix()))
+	data[8] = byte(difficulty)
+	copy(data[9+randomSize:], Issuer{Secret: secret}.mac(data[:9+randomSize]))
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want int
+	}{
+		{data: []byte{}, want: 0},
+		{data: []byte{0xff}, want: 0},
+		{data: []byte{0x80, 0x00}, want: 0},
+		{data: []byte{0x7f}, want: 1},
+		{data: []byte{0x01}, want: 7},
+		{data: []byte{0x00}, want: 8},
+		{data: []byte{0x00, 0x80}, want: 8},
+		{data: []byte{0x00, 0x0f, 0xff}, want: 12},
+		{data: []byte{0x00, 0x00, 0x01}, want: 23},
+		{data: []byte{0x00, 0x00, 0x00}, want: 24},
+	}
+
+	for _, test := range tests {
+		if got := leadingZeroBits(test.data); got != test.want {
+			t.Errorf("leadingZeroBits(%x) = %d, want %d", test.data, got, test.want)
+		}
+	}
+}
+
+func TestIssue(t *testing.T) {
+	issuer := Issuer{Secret: []byte("secret"), Difficulty: 12, TTL: 5 * time.Minute}
+
+	challenge, err := issuer.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if challenge.Difficulty != 12 {
+		t.Errorf("difficulty = %d, want 12", challenge.Difficulty)
+	}
+
+	if ttl := time.Until(challenge.ExpiresAt); ttl <= 4*time.Minute || ttl > 5*time.Minute {
+		t.Errorf("challenge expires in %s, want about 5m", ttl)
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(challenge.Challenge)
+	if err != nil || len(data) != challengeSize {
+		t.Fatalf("challenge %q is not %d base64url bytes", challenge.Challenge, challengeSize)
+	}
+
+	if int64(binary.BigEndian.Uint64(data[:8])) != challenge.ExpiresAt.Unix() || data[8] != 12 {
+		t.Errorf("challenge does not embed its expiry and difficulty")
+	}
+
+	other, err := issuer.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if other.Challenge == challenge.Challenge {
+		t.Errorf("two issued challenges are equal")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	secret := []byte("secret")
+	issuer := Issuer{Secret: secret, Difficulty: 8, TTL: time.Minute}
+	address := "sent1ptqd6902tgrvl5zsj2dm5q4hvvdajh35f59dur"
+
+	valid := forge(secret, time.Now().Add(time.Minute), 8)
+	expired := forge(secret, time.Now().Add(-time.Second), 8)
+	foreign := forge([]byte("other secret"), time.Now().Add(time.Minute), 8)
+	easier := forge(secret, time.Now().Add(time.Minute), 0)
+
+	tampered, _ := base64.RawURLEncoding.DecodeString(valid)
+	tampered[8] = 0
+
+	tests := []struct {
+		name      string
+		challenge string
+		address   string
+		nonce     string
+		want      error
+	}{
+		{name: "valid", challenge: valid, address: address, nonce: solve(t, valid, address, 8)},
+		{name: "zero difficulty", challenge: easier, address: address, nonce: "anything"},
+		{name: "insufficient work", challenge: valid, address: address, nonce: unsolved(t, valid, address, 8), want: ErrInsufficientWork},
+		{name: "expired", challenge: expired, address: address, nonce: solve(t, expired, address, 8), want: ErrExpired},
+		{name: "other secret", challenge: foreign, address: address, nonce: solve(t, foreign, address, 8), want: ErrUnknown},
+		{name: "lowered difficulty", challenge: base64.RawURLEncoding.EncodeToString(tampered), address: address, nonce: "0", want: ErrUnknown},
+		{name: "not base64", challenge: "not base64!", address: address, nonce: "0", want: ErrMalformed},
+		{name: "truncated", challenge: valid[:20], address: address, nonce: "0", want: ErrMalformed},
+		{name: "empty", challenge: "", address: address, nonce: "0", want: ErrMalformed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expiresAt, err := issuer.Verify(test.challenge, test.address, test.nonce)
+			if !errors.Is(err, test.want) || (test.want == nil && err != nil) {
+				t.Fatalf("Verify() error = %v, want %v", err, test.want)
+			}
+
+			if err == nil && expiresAt.IsZero() {
+				t.Errorf("Verify() returned no expiry")
+			}
+		})
+	}
+}
+
+func TestRedeem(t *testing.T) {
+	issuer := Issuer{Secret: []byte("secret"), Difficulty: 4, TTL: time.Minute}
+	address := "sent1ptqd6902tgrvl5zsj2dm5q4hvvdajh35f59dur"
+
+	challenge, err := issuer.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nonce := solve(t, challenge.Challenge, address, 4)
+	registry := memoryRegistry{}
+
+	err = issuer.Redeem(registry, challenge.Challenge, address, nonce)
+	if err != nil {
+		t.Fatalf("first Redeem() error = %v", err)
+	}
+
+	err = issuer.Redeem(registry, challenge.Challenge, address, nonce)
+	if !errors.Is(err, ErrReused) || !IsRejection(err) {
+		t.Fatalf("second Redeem() error = %v, want %v", err, ErrReused)
+	}
+
+	other, err := issuer.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = issuer.Redeem(registry, other.Challenge, address, unsolved(t, other.Challenge, address, 4))
+	if !errors.Is(err, ErrInsufficientWork) {
+		t.Fatalf("unsolved Redeem() error = %v, want %v", err, ErrInsufficientWork)
+	}
+
+	if registry[other.Challenge] {
+		t.Errorf("unsolved challenge was claimed")
+	}
+
+	err = issuer.Redeem(failingRegistry{}, other.Challenge, address, solve(t, other.Challenge, address, 4))
+	if err == nil || IsRejection(err) {
+		t.Fatalf("Redeem() with failing registry error = %v, want a storage error", err)
+	}
+}
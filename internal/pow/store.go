@@ -0,0 +1,25 @@
+package pow
+
+import (
+	"dvpn/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ChallengeStore struct {
+	DB *gorm.DB
+}
+
+func (s *ChallengeStore) Claim(challenge string, expiresAt time.Time) (bool, error) {
+	tx := s.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RegistrationChallenge{
+		Challenge: challenge,
+		ExpiresAt: expiresAt,
+	})
+	if tx.Error != nil {
+		return false, tx.Error
+	}
+
+	return tx.RowsAffected == 1, nil
+}
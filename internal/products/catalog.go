@@ -0,0 +1,169 @@
+package products
+
+import (
+	"dvpn/models"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Entry is a product as it is sold in a single store, with the overrides of that store applied.
+type Entry struct {
+	ID             uint       `json:"id"`
+	StoreProductId string     `json:"store_product_id"`
+	Name           string     `json:"name"`
+	Amount         int64      `json:"amount"`
+	Denom          string     `json:"denom"`
+	IsSubscription bool       `json:"is_subscription"`
+	ActiveFrom     *time.Time `json:"active_from"`
+	ActiveUntil    *time.Time `json:"active_until"`
+}
+
+func (e Entry) IsActive(at time.Time) bool {
+	if e.ActiveFrom != nil && at.Before(*e.ActiveFrom) {
+		return false
+	}
+
+	return e.ActiveUntil == nil || at.Before(*e.ActiveUntil)
+}
+
+type Catalog struct {
+	DB  *gorm.DB
+	TTL time.Duration
+
+	mu       sync.RWMutex
+	loadedAt time.Time
+	products []models.Product
+}
+
+func (c *Catalog) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.loadedAt = time.Time{}
+}
+
+// Resolve returns the product sold under storeProductId in the store, or nil if there is none.
+// A product whose override for the store sets that ID wins over a product merely sold under it
+// everywhere. The active window is not checked, since a store can complete a purchase started
+// before the product was withdrawn.
+func (c *Catalog) Resolve(store string, storeProductId string) (*Entry, error) {
+	err := c.refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var fallback *Entry
+	for _, product := range c.products {
+		entry := entryFor(product, store)
+		if entry.StoreProductId != storeProductId {
+			continue
+		}
+
+		if entry.StoreProductId != product.StoreProductId {
+			return &entry, nil
+		}
+
+		if fallback == nil {
+			fallback = &entry
+		}
+	}
+
+	return fallback, nil
+}
+
+// Active returns the products on sale in the store at the given time, sorted by amount. Overrides
+// are not applied when store is empty.
+func (c *Catalog) Active(store string, at time.Time) ([]Entry, error) {
+	err := c.refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entries := make([]Entry, 0, len(c.products))
+	for _, product := range c.products {
+		entry := entryFor(product, store)
+		if entry.IsActive(at) {
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Denom != entries[j].Denom {
+			return entries[i].Denom < entries[j].Denom
+		}
+
+		return entries[i].Amount < entries[j].Amount
+	})
+
+	return entries, nil
+}
+
+func (c *Catalog) refresh() error {
+	c.mu.RLock()
+	isFresh := !c.loadedAt.IsZero() && time.Since(c.loadedAt) < c.TTL
+	c.mu.RUnlock()
+
+	if isFresh {
+		return nil
+	}
+
+	var products []models.Product
+	tx := c.DB.Preload("Overrides").Order("id").Find(&products)
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.products = products
+	c.loadedAt = time.Now()
+
+	return nil
+}
+
+func entryFor(product models.Product, store string) Entry {
+	entry := Entry{
+		ID:             product.ID,
+		StoreProductId: product.StoreProductId,
+		Name:           product.Name,
+		Amount:         product.Amount,
+		Denom:          product.Denom,
+		IsSubscription: product.IsSubscription,
+		ActiveFrom:     product.ActiveFrom,
+		ActiveUntil:    product.ActiveUntil,
+	}
+
+	if store == "" {
+		return entry
+	}
+
+	for _, override := range product.Overrides {
+		if override.Store != store {
+			continue
+		}
+
+		if override.StoreProductId != nil {
+			entry.StoreProductId = *override.StoreProductId
+		}
+
+		if override.Amount != nil {
+			entry.Amount = *override.Amount
+		}
+
+		if override.Denom != nil {
+			entry.Denom = *override.Denom
+		}
+	}
+
+	return entry
+}
@@ -0,0 +1,131 @@
+package products
+
+import (
+	"dvpn/models"
+	"testing"
+	"time"
+)
+
+func loadedCatalog(products ...models.Product) *Catalog {
+	return &Catalog{
+		TTL:      time.Hour,
+		loadedAt: time.Now(),
+		products: products,
+	}
+}
+
+func product(id uint, storeProductId string, amount int64, overrides ...models.ProductOverride) models.Product {
+	p := models.Product{
+		StoreProductId: storeProductId,
+		Name:           storeProductId,
+		Amount:         amount,
+		Denom:          "udvpn",
+		Overrides:      overrides,
+	}
+	p.ID = id
+
+	return p
+}
+
+func TestCatalogResolve(t *testing.T) {
+	playProductId := "dvpn_5000_android"
+	playAmount := int64(4500)
+	sharedProductId := "dvpn_10000"
+	appStoreDenom := "uatom"
+	retiredAt := time.Now().Add(-time.Hour)
+
+	retired := product(4, "dvpn_legacy", 100)
+	retired.ActiveUntil = &retiredAt
+
+	catalog := loadedCatalog(
+		product(1, "dvpn_5000", 5000, models.ProductOverride{Store: "PLAY_STORE", StoreProductId: &playProductId, Amount: &playAmount}),
+		product(2, "dvpn_10000", 10000, models.ProductOverride{Store: "APP_STORE", Denom: &appStoreDenom}),
+		product(3, "dvpn_20000", 20000, models.ProductOverride{Store: "PLAY_STORE", StoreProductId: &sharedProductId}),
+		retired,
+	)
+
+	tests := []struct {
+		name           string
+		store          string
+		storeProductId string
+		wantID         uint
+		wantAmount     int64
+		wantDenom      string
+	}{
+		{name: "base product", store: "APP_STORE", storeProductId: "dvpn_5000", wantID: 1, wantAmount: 5000, wantDenom: "udvpn"},
+		{name: "overridden store product id", store: "PLAY_STORE", storeProductId: "dvpn_5000_android", wantID: 1, wantAmount: 4500, wantDenom: "udvpn"},
+		{name: "base id replaced in overridden store", store: "PLAY_STORE", storeProductId: "dvpn_5000"},
+		{name: "override of another store", store: "APP_STORE", storeProductId: "dvpn_5000_android"},
+		{name: "overridden denom only", store: "APP_STORE", storeProductId: "dvpn_10000", wantID: 2, wantAmount: 10000, wantDenom: "uatom"},
+		{name: "id taken over by override", store: "PLAY_STORE", storeProductId: "dvpn_10000", wantID: 3, wantAmount: 20000, wantDenom: "udvpn"},
+		{name: "id not overridden elsewhere", store: "STRIPE", storeProductId: "dvpn_10000", wantID: 2, wantAmount: 10000, wantDenom: "udvpn"},
+		{name: "no store", store: "", storeProductId: "dvpn_5000_android"},
+		{name: "no store base product", store: "", storeProductId: "dvpn_20000", wantID: 3, wantAmount: 20000, wantDenom: "udvpn"},
+		{name: "retired product", store: "APP_STORE", storeProductId: "dvpn_legacy", wantID: 4, wantAmount: 100, wantDenom: "udvpn"},
+		{name: "case sensitive", store: "APP_STORE", storeProductId: "DVPN_5000"},
+		{name: "unknown", store: "APP_STORE", storeProductId: "dvpn_1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entry, err := catalog.Resolve(test.store, test.storeProductId)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.wantID == 0 {
+				if entry != nil {
+					t.Fatalf("Resolve() = %+v, want nil", entry)
+				}
+
+				return
+			}
+
+			if entry == nil {
+				t.Fatalf("Resolve() = nil, want product %d", test.wantID)
+			}
+
+			if entry.ID != test.wantID || entry.StoreProductId != test.storeProductId || entry.Amount != test.wantAmount || entry.Denom != test.wantDenom {
+				t.Errorf("Resolve() = %+v, want product %d with %d%s", entry, test.wantID, test.wantAmount, test.wantDenom)
+			}
+		})
+	}
+}
+
+func TestCatalogActive(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+	playAmount := int64(1)
+
+	upcoming := product(3, "dvpn_upcoming", 300)
+	upcoming.ActiveFrom = &future
+
+	retired := product(4, "dvpn_retired", 400)
+	retired.ActiveUntil = &past
+
+	catalog := loadedCatalog(
+		product(1, "dvpn_large", 2000),
+		product(2, "dvpn_small", 1000, models.ProductOverride{Store: "PLAY_STORE", Amount: &playAmount}),
+		upcoming,
+		retired,
+	)
+
+	entries, err := catalog.Active("APP_STORE", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 || entries[0].ID != 2 || entries[1].ID != 1 {
+		t.Fatalf("Active() = %+v, want products 2 and 1", entries)
+	}
+
+	entries, err = catalog.Active("PLAY_STORE", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 || entries[0].ID != 2 || entries[0].Amount != 1 {
+		t.Fatalf("Active() = %+v, want overridden product 2 first", entries)
+	}
+}
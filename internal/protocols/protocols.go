@@ -0,0 +1,158 @@
+package protocols
+
+import (
+	"dvpn/internal/semver"
+	"dvpn/models"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+)
+
+//go:embed protocols.json
+var defaultProtocols []byte
+
+// All is the protocol filter value that selects every supported protocol.
+const All = "ALL"
+
+type Protocol struct {
+	Name           models.ServerProtocol `json:"name"`
+	TypeCode       int64                 `json:"type_code"`
+	IsEnabled      bool                  `json:"is_enabled"`
+	Capabilities   []string              `json:"capabilities"`
+	MinAppVersions map[string]string     `json:"min_app_versions"`
+}
+
+type Registry struct {
+	Protocols []Protocol
+}
+
+func Load(path string) (*Registry, error) {
+	data := defaultProtocols
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var protocols []Protocol
+	err := json.Unmarshal(data, &protocols)
+	if err != nil {
+		return nil, errors.New("failed to parse protocols: " + err.Error())
+	}
+
+	names := make(map[models.ServerProtocol]bool)
+	typeCodes := make(map[int64]bool)
+
+	for i := range protocols {
+		protocols[i].Name = models.ServerProtocol(NormalizeName(string(protocols[i].Name)))
+
+		// SupportedBy looks platforms up in lowercase.
+		minAppVersions := make(map[string]string)
+		for platform, version := range protocols[i].MinAppVersions {
+			platform = strings.ToLower(strings.TrimSpace(platform))
+			if _, ok := minAppVersions[platform]; ok {
+				return nil, errors.New("duplicate " + platform + " minimum app version for protocol " + string(protocols[i].Name))
+			}
+
+			minAppVersions[platform] = version
+		}
+		protocols[i].MinAppVersions = minAppVersions
+	}
+
+	for _, protocol := range protocols {
+		if protocol.Name == "" || protocol.Name == All || names[protocol.Name] {
+			return nil, errors.New("invalid or duplicate protocol name " + string(protocol.Name))
+		}
+
+		if typeCodes[protocol.TypeCode] {
+			return nil, errors.New("duplicate type code for protocol " + string(protocol.Name))
+		}
+
+		for platform, version := range protocol.MinAppVersions {
+			if _, err := semver.Parse(version); err != nil {
+				return nil, errors.New("invalid " + platform + " minimum app version for protocol " + string(protocol.Name) + ": " + err.Error())
+			}
+		}
+
+		names[protocol.Name] = true
+		typeCodes[protocol.TypeCode] = true
+	}
+
+	return &Registry{Protocols: protocols}, nil
+}
+
+func (r Registry) ByTypeCode(typeCode int64) (*Protocol, bool) {
+	for i := range r.Protocols {
+		if r.Protocols[i].TypeCode == typeCode && r.Protocols[i].IsEnabled {
+			return &r.Protocols[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// NormalizeName returns the canonical uppercase form of a protocol name, as stored on servers.
+func NormalizeName(name string) string {
+	return strings.ToUpper(strings.TrimSpace(name))
+}
+
+func (r Registry) ByName(name string) (*Protocol, bool) {
+	name = NormalizeName(name)
+	for i := range r.Protocols {
+		if string(r.Protocols[i].Name) == name && r.Protocols[i].IsEnabled {
+			return &r.Protocols[i], true
+		}
+	}
+
+	return nil, false
+}
+
+func (r Registry) Enabled() []Protocol {
+	var protocols []Protocol
+	for _, protocol := range r.Protocols {
+		if protocol.IsEnabled {
+			protocols = append(protocols, protocol)
+		}
+	}
+
+	return protocols
+}
+
+// SupportedBy returns the enabled protocols the given app build can connect to.
+// Requests without a known platform or version are not filtered.
+func (r Registry) SupportedBy(platform string, appVersion string) []Protocol {
+	version, err := semver.Parse(appVersion)
+	if platform == "" || err != nil {
+		return r.Enabled()
+	}
+
+	var protocols []Protocol
+	for _, protocol := range r.Enabled() {
+		minVersion, ok := protocol.MinAppVersions[strings.ToLower(platform)]
+		if ok && version.Compare(semverOrZero(minVersion)) < 0 {
+			continue
+		}
+
+		protocols = append(protocols, protocol)
+	}
+
+	return protocols
+}
+
+func Names(protocols []Protocol) []string {
+	names := make([]string, 0, len(protocols))
+	for _, protocol := range protocols {
+		names = append(names, string(protocol.Name))
+	}
+
+	return names
+}
+
+func semverOrZero(value string) semver.Version {
+	version, _ := semver.Parse(value)
+	return version
+}
@@ -0,0 +1,84 @@
+package protocols
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func load(t *testing.T, data string) (*Registry, error) {
+	path := filepath.Join(t.TempDir(), "protocols.json")
+	err := os.WriteFile(path, []byte(data), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return Load(path)
+}
+
+func TestLoadNormalizesMinAppVersionPlatforms(t *testing.T) {
+	registry, err := load(t, `[{"name": "wireguard", "type_code": 1, "is_enabled": true, "min_app_versions": {"Android": "2.0.0", " IOS ": "3.1"}}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	protocol := registry.Protocols[0]
+	if protocol.Name != "WIREGUARD" || protocol.MinAppVersions["android"] != "2.0.0" || protocol.MinAppVersions["ios"] != "3.1" || len(protocol.MinAppVersions) != 2 {
+		t.Fatalf("Load() = %+v, want normalized name and platforms", protocol)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{name: "duplicate platform", data: `[{"name": "WIREGUARD", "type_code": 1, "min_app_versions": {"android": "1.0.0", "ANDROID": "2.0.0"}}]`, wantErr: "duplicate android minimum app version"},
+		{name: "invalid app version", data: `[{"name": "WIREGUARD", "type_code": 1, "min_app_versions": {"android": "latest"}}]`, wantErr: "invalid android minimum app version"},
+		{name: "duplicate name", data: `[{"name": "WIREGUARD", "type_code": 1}, {"name": "wireguard", "type_code": 2}]`, wantErr: "duplicate protocol name"},
+		{name: "reserved name", data: `[{"name": "all", "type_code": 1}]`, wantErr: "duplicate protocol name"},
+		{name: "duplicate type code", data: `[{"name": "WIREGUARD", "type_code": 1}, {"name": "V2RAY", "type_code": 1}]`, wantErr: "duplicate type code"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := load(t, test.data)
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("Load() error = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestSupportedBy(t *testing.T) {
+	registry, err := load(t, `[
+		{"name": "WIREGUARD", "type_code": 1, "is_enabled": true},
+		{"name": "V2RAY", "type_code": 2, "is_enabled": true, "min_app_versions": {"Android": "2.0.0"}},
+		{"name": "OPENVPN", "type_code": 3, "is_enabled": false}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		platform string
+		version  string
+		want     string
+	}{
+		{platform: "android", version: "1.9.9", want: "WIREGUARD"},
+		{platform: "ANDROID", version: "1.9.9", want: "WIREGUARD"},
+		{platform: "android", version: "2.0.0", want: "WIREGUARD,V2RAY"},
+		{platform: "ios", version: "1.0.0", want: "WIREGUARD,V2RAY"},
+		{platform: "", version: "1.0.0", want: "WIREGUARD,V2RAY"},
+		{platform: "android", version: "", want: "WIREGUARD,V2RAY"},
+	}
+
+	for _, test := range tests {
+		got := strings.Join(Names(registry.SupportedBy(test.platform, test.version)), ",")
+		if got != test.want {
+			t.Errorf("SupportedBy(%q, %q) = %s, want %s", test.platform, test.version, got, test.want)
+		}
+	}
+}
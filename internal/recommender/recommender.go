@@ -0,0 +1,146 @@
+package recommender
+
+import (
+	"dvpn/models"
+	"math"
+	"sort"
+)
+
+const earthRadiusKm = 6371.0
+
+type Weights struct {
+	Distance  float64
+	Load      float64
+	Bandwidth float64
+	Protocol  float64
+}
+
+var DefaultWeights = Weights{
+	Distance:  0.45,
+	Load:      0.25,
+	Bandwidth: 0.20,
+	Protocol:  0.10,
+}
+
+type Location struct {
+	Latitude  float64
+	Longitude float64
+}
+
+type Request struct {
+	Location          *Location
+	PreferredProtocol models.ServerProtocol
+	Limit             int
+}
+
+type ScoreParts struct {
+	DistanceKm *float64 `json:"distance_km"`
+	Distance   float64  `json:"distance"`
+	Load       float64  `json:"load"`
+	Bandwidth  float64  `json:"bandwidth"`
+	Protocol   float64  `json:"protocol"`
+}
+
+type Recommendation struct {
+	Server models.Server `json:"server"`
+	Score  float64       `json:"score"`
+	Parts  ScoreParts    `json:"parts"`
+}
+
+type Recommender struct {
+	Weights Weights
+}
+
+func (r Recommender) Rank(servers []models.Server, request Request) []Recommendation {
+	var maxBandwidth int64
+	for _, server := range servers {
+		bandwidth := serverBandwidth(server)
+		if bandwidth > maxBandwidth {
+			maxBandwidth = bandwidth
+		}
+	}
+
+	recommendations := make([]Recommendation, 0, len(servers))
+	for _, server := range servers {
+		configuration := server.Configuration.Data()
+
+		var parts ScoreParts
+
+		if request.Location != nil {
+			distanceKm := Haversine(request.Location.Latitude, request.Location.Longitude, configuration.LocationLat, configuration.LocationLon)
+			parts.DistanceKm = &distanceKm
+			parts.Distance = r.Weights.Distance * math.Exp(-distanceKm/2000)
+		}
+
+		parts.Load = r.Weights.Load * (1 - clamp(server.CurrentLoad))
+
+		if maxBandwidth > 0 {
+			parts.Bandwidth = r.Weights.Bandwidth * math.Log1p(float64(serverBandwidth(server))) / math.Log1p(float64(maxBandwidth))
+		}
+
+		if request.PreferredProtocol == "" || request.PreferredProtocol == server.Protocol {
+			parts.Protocol = r.Weights.Protocol
+		}
+
+		recommendations = append(recommendations, Recommendation{
+			Server: server,
+			Score:  round(parts.Distance + parts.Load + parts.Bandwidth + parts.Protocol),
+			Parts: ScoreParts{
+				DistanceKm: parts.DistanceKm,
+				Distance:   round(parts.Distance),
+				Load:       round(parts.Load),
+				Bandwidth:  round(parts.Bandwidth),
+				Protocol:   round(parts.Protocol),
+			},
+		})
+	}
+
+	sort.SliceStable(recommendations, func(i, j int) bool {
+		return recommendations[i].Score > recommendations[j].Score
+	})
+
+	if request.Limit > 0 && len(recommendations) > request.Limit {
+		recommendations = recommendations[:request.Limit]
+	}
+
+	return recommendations
+}
+
+func Haversine(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+	toRadians := func(deg float64) float64 {
+		return deg * math.Pi / 180
+	}
+
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return earthRadiusKm * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+func serverBandwidth(server models.Server) int64 {
+	configuration := server.Configuration.Data()
+	if configuration.BandwidthDownload < configuration.BandwidthUpload {
+		return configuration.BandwidthDownload
+	}
+
+	return configuration.BandwidthUpload
+}
+
+func clamp(value float64) float64 {
+	if value < 0 {
+		return 0
+	}
+
+	if value > 1 {
+		return 1
+	}
+
+	return value
+}
+
+func round(value float64) float64 {
+	return math.Round(value*10000) / 10000
+}
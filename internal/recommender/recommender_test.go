@@ -0,0 +1,176 @@
+package recommender
+
+import (
+	"dvpn/models"
+	"math"
+	"strings"
+	"testing"
+
+	"gorm.io/datatypes"
+)
+
+func server(address string, protocol models.ServerProtocol, load float64, bandwidth int64, lat float64, lon float64) models.Server {
+	return models.Server{
+		Address:     address,
+		Protocol:    protocol,
+		CurrentLoad: load,
+		Configuration: datatypes.NewJSONType(models.ServerConfiguration{
+			BandwidthDownload: bandwidth,
+			BandwidthUpload:   bandwidth,
+			LocationLat:       lat,
+			LocationLon:       lon,
+		}),
+	}
+}
+
+func addresses(recommendations []Recommendation) string {
+	var result []string
+	for _, recommendation := range recommendations {
+		result = append(result, recommendation.Server.Address)
+	}
+
+	return strings.Join(result, ",")
+}
+
+func TestHaversine(t *testing.T) {
+	tests := []struct {
+		name       string
+		lat1, lon1 float64
+		lat2, lon2 float64
+		want       float64
+	}{
+		{name: "same point", lat1: 48.8566, lon1: 2.3522, lat2: 48.8566, lon2: 2.3522, want: 0},
+		{name: "one degree along the equator", lat1: 0, lon1: 0, lat2: 0, lon2: 1, want: 111.1949},
+		{name: "equator to pole", lat1: 0, lon1: 0, lat2: 90, lon2: 0, want: 10007.5434},
+		{name: "antipodes", lat1: 0, lon1: 0, lat2: 0, lon2: 180, want: 20015.0868},
+		{name: "across the antimeridian", lat1: 0, lon1: 179.5, lat2: 0, lon2: -179.5, want: 111.1949},
+		{name: "paris to london", lat1: 48.8566, lon1: 2.3522, lat2: 51.5074, lon2: -0.1278, want: 343.5561},
+		{name: "new york to london", lat1: 40.7128, lon1: -74.0060, lat2: 51.5074, lon2: -0.1278, want: 5570.2222},
+		{name: "tokyo to sydney", lat1: 35.6762, lon1: 139.6503, lat2: -33.8688, lon2: 151.2093, want: 7825.8186},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Haversine(test.lat1, test.lon1, test.lat2, test.lon2)
+			if math.Abs(got-test.want) > 0.001 {
+				t.Errorf("Haversine() = %.4f, want %.4f", got, test.want)
+			}
+
+			reversed := Haversine(test.lat2, test.lon2, test.lat1, test.lon1)
+			if math.Abs(reversed-got) > 1e-9 {
+				t.Errorf("Haversine() is not symmetric: %.4f and %.4f", got, reversed)
+			}
+		})
+	}
+}
+
+func TestRank(t *testing.T) {
+	paris := &Location{Latitude: 48.8566, Longitude: 2.3522}
+
+	tests := []struct {
+		name    string
+		servers []models.Server
+		request Request
+		want    string
+	}{
+		{
+			name: "nearer first",
+			servers: []models.Server{
+				server("new-york", "WIREGUARD", 0.5, 1000, 40.7128, -74.0060),
+				server("london", "WIREGUARD", 0.5, 1000, 51.5074, -0.1278),
+				server("tokyo", "WIREGUARD", 0.5, 1000, 35.6762, 139.6503),
+			},
+			request: Request{Location: paris},
+			want:    "london,new-york,tokyo",
+		},
+		{
+			name: "less loaded first",
+			servers: []models.Server{
+				server("busy", "WIREGUARD", 0.9, 1000, 0, 0),
+				server("idle", "WIREGUARD", 0.1, 1000, 0, 0),
+				server("overloaded", "WIREGUARD", 1.5, 1000, 0, 0),
+			},
+			want: "idle,busy,overloaded",
+		},
+		{
+			name: "faster first",
+			servers: []models.Server{
+				server("slow", "WIREGUARD", 0.5, 10, 0, 0),
+				server("fast", "WIREGUARD", 0.5, 100000, 0, 0),
+				server("unmeasured", "WIREGUARD", 0.5, 0, 0, 0),
+			},
+			want: "fast,slow,unmeasured",
+		},
+		{
+			name: "preferred protocol first",
+			servers: []models.Server{
+				server("wireguard", "WIREGUARD", 0.5, 1000, 0, 0),
+				server("v2ray", "V2RAY", 0.5, 1000, 0, 0),
+			},
+			request: Request{PreferredProtocol: "V2RAY"},
+			want:    "v2ray,wireguard",
+		},
+		{
+			name: "distance outweighs load",
+			servers: []models.Server{
+				server("far-idle", "WIREGUARD", 0, 1000, 35.6762, 139.6503),
+				server("near-busy", "WIREGUARD", 0.8, 1000, 51.5074, -0.1278),
+			},
+			request: Request{Location: paris},
+			want:    "near-busy,far-idle",
+		},
+		{
+			name: "ties keep their order",
+			servers: []models.Server{
+				server("first", "WIREGUARD", 0.5, 1000, 0, 0),
+				server("second", "WIREGUARD", 0.5, 1000, 0, 0),
+			},
+			want: "first,second",
+		},
+		{
+			name: "limit",
+			servers: []models.Server{
+				server("busy", "WIREGUARD", 0.9, 1000, 0, 0),
+				server("idle", "WIREGUARD", 0.1, 1000, 0, 0),
+				server("average", "WIREGUARD", 0.5, 1000, 0, 0),
+			},
+			request: Request{Limit: 2},
+			want:    "idle,average",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recommendations := Recommender{Weights: DefaultWeights}.Rank(test.servers, test.request)
+			if got := addresses(recommendations); got != test.want {
+				t.Fatalf("Rank() = %s, want %s", got, test.want)
+			}
+
+			for i := 1; i < len(recommendations); i++ {
+				if recommendations[i].Score > recommendations[i-1].Score {
+					t.Errorf("Rank() scores are not descending: %v", recommendations)
+				}
+			}
+		})
+	}
+}
+
+func TestRankScoreParts(t *testing.T) {
+	servers := []models.Server{server("idle", "WIREGUARD", 0, 1000, 0, 0)}
+
+	recommendations := Recommender{Weights: DefaultWeights}.Rank(servers, Request{})
+	parts := recommendations[0].Parts
+	if parts.DistanceKm != nil || parts.Distance != 0 {
+		t.Errorf("distance parts without a location = %v, %v, want none", parts.DistanceKm, parts.Distance)
+	}
+
+	if parts.Load != 0.25 || parts.Bandwidth != 0.2 || parts.Protocol != 0.1 || recommendations[0].Score != 0.55 {
+		t.Errorf("Rank() = %+v, want full load, bandwidth and protocol parts", recommendations[0])
+	}
+
+	recommendations = Recommender{Weights: DefaultWeights}.Rank(servers, Request{Location: &Location{}})
+	parts = recommendations[0].Parts
+	if parts.DistanceKm == nil || *parts.DistanceKm != 0 || parts.Distance != 0.45 || recommendations[0].Score != 1 {
+		t.Errorf("Rank() at the server location = %+v, want the full distance part", recommendations[0])
+	}
+}
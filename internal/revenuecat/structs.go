@@ -1,12 +1,120 @@
 package revenuecat
 
+import "time"
+
+const (
+	EventTypeTest                 = "TEST"
+	EventTypeInitialPurchase      = "INITIAL_PURCHASE"
+	EventTypeNonRenewingPurchase  = "NON_RENEWING_PURCHASE"
+	EventTypeRenewal              = "RENEWAL"
+	EventTypeProductChange        = "PRODUCT_CHANGE"
+	EventTypeCancellation         = "CANCELLATION"
+	EventTypeUncancellation       = "UNCANCELLATION"
+	EventTypeRefund               = "REFUND"
+	EventTypeBillingIssue         = "BILLING_ISSUE"
+	EventTypeSubscriberAlias      = "SUBSCRIBER_ALIAS"
+	EventTypeSubscriptionPaused   = "SUBSCRIPTION_PAUSED"
+	EventTypeSubscriptionExtended = "SUBSCRIPTION_EXTENDED"
+	EventTypeTransfer             = "TRANSFER"
+	EventTypeExpiration           = "EXPIRATION"
+)
+
+const (
+	EnvironmentProduction = "PRODUCTION"
+	EnvironmentSandbox    = "SANDBOX"
+)
+
+const (
+	PeriodTypeNormal = "NORMAL"
+	PeriodTypeTrial  = "TRIAL"
+	PeriodTypeIntro  = "INTRO"
+)
+
 type Event struct {
-	Id          string `json:"id"`
-	Environment string `json:"environment"`
-	ProductId   string `json:"product_id"`
-	AppUserId   string `json:"app_user_id"`
+	Id                string `json:"id"`
+	Type              string `json:"type"`
+	EventTimestampMs  int64  `json:"event_timestamp_ms"`
+	AppId             string `json:"app_id"`
+	Environment       string `json:"environment"`
+	Store             string `json:"store"`
+	CountryCode       string `json:"country_code"`
+	AppUserId         string `json:"app_user_id"`
+	OriginalAppUserId string `json:"original_app_user_id"`
+
+	Aliases         []string `json:"aliases"`
+	TransferredFrom []string `json:"transferred_from"`
+	TransferredTo   []string `json:"transferred_to"`
+
+	ProductId      string   `json:"product_id"`
+	NewProductId   *string  `json:"new_product_id"`
+	EntitlementIds []string `json:"entitlement_ids"`
+	PeriodType     string   `json:"period_type"`
+
+	TransactionId         string `json:"transaction_id"`
+	OriginalTransactionId string `json:"original_transaction_id"`
+
+	PurchasedAtMs             *int64   `json:"purchased_at_ms"`
+	ExpirationAtMs            *int64   `json:"expiration_at_ms"`
+	GracePeriodExpirationAtMs *int64   `json:"grace_period_expiration_at_ms"`
+	AutoResumeAtMs            *int64   `json:"auto_resume_at_ms"`
+	RenewalNumber             *int64   `json:"renewal_number"`
+	IsFamilyShare             *bool    `json:"is_family_share"`
+	IsTrialConversion         *bool    `json:"is_trial_conversion"`
+	OfferCode                 string   `json:"offer_code"`
+	PresentedOfferingId       string   `json:"presented_offering_id"`
+	CancelReason              string   `json:"cancel_reason"`
+	ExpirationReason          string   `json:"expiration_reason"`
+	TakehomePercentage        *float64 `json:"takehome_percentage"`
+	Price                     *float64 `json:"price"`
+	PriceInPurchasedCurrency  *float64 `json:"price_in_purchased_currency"`
+	Currency                  string   `json:"currency"`
+	TaxPercentage             *float64 `json:"tax_percentage"`
+	CommissionPercentage      *float64 `json:"commission_percentage"`
 }
 
 type Payload struct {
-	Event Event `json:"event"`
+	ApiVersion string `json:"api_version"`
+	Event      Event  `json:"event"`
+}
+
+// UserIds returns the app user ID, the original app user ID and the aliases, in that order and
+// without duplicates. Anonymous RevenueCat IDs are included; callers pick the one they recognise.
+func (e Event) UserIds() []string {
+	seen := make(map[string]bool)
+	var ids []string
+
+	for _, id := range append([]string{e.AppUserId, e.OriginalAppUserId}, e.Aliases...) {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+// IsUnpaid reports whether the event is for a free trial or a period the user was not charged for.
+func (e Event) IsUnpaid() bool {
+	return e.PeriodType == PeriodTypeTrial || (e.Price != nil && *e.Price == 0)
+}
+
+func (e Event) PurchasedAt() *time.Time {
+	return millisToTime(e.PurchasedAtMs)
+}
+
+func (e Event) ExpirationAt() *time.Time {
+	return millisToTime(e.ExpirationAtMs)
+}
+
+func (e Event) GracePeriodExpirationAt() *time.Time {
+	return millisToTime(e.GracePeriodExpirationAtMs)
+}
+
+func millisToTime(ms *int64) *time.Time {
+	if ms == nil {
+		return nil
+	}
+
+	t := time.UnixMilli(*ms).UTC()
+	return &t
 }
@@ -0,0 +1,130 @@
+package semver
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Version struct {
+	Major      int64
+	Minor      int64
+	Patch      int64
+	Prerelease string
+}
+
+func Parse(value string) (Version, error) {
+	var version Version
+
+	value = strings.TrimPrefix(strings.TrimSpace(value), "v")
+	if value == "" {
+		return version, errors.New("empty version")
+	}
+
+	if index := strings.IndexByte(value, '+'); index != -1 {
+		value = value[:index]
+	}
+
+	if index := strings.IndexByte(value, '-'); index != -1 {
+		version.Prerelease = value[index+1:]
+		value = value[:index]
+	}
+
+	parts := strings.Split(value, ".")
+	if len(parts) > 3 {
+		return version, errors.New("invalid version " + value)
+	}
+
+	numbers := make([]int64, 3)
+	for i, part := range parts {
+		number, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || number < 0 {
+			return version, errors.New("invalid version " + value)
+		}
+
+		numbers[i] = number
+	}
+
+	version.Major, version.Minor, version.Patch = numbers[0], numbers[1], numbers[2]
+
+	return version, nil
+}
+
+func (v Version) Compare(other Version) int {
+	if v.Major != other.Major {
+		return compareInts(v.Major, other.Major)
+	}
+
+	if v.Minor != other.Minor {
+		return compareInts(v.Minor, other.Minor)
+	}
+
+	if v.Patch != other.Patch {
+		return compareInts(v.Patch, other.Patch)
+	}
+
+	return comparePrerelease(v.Prerelease, other.Prerelease)
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+
+	return s
+}
+
+func compareInts(a int64, b int64) int {
+	if a < b {
+		return -1
+	}
+
+	if a > b {
+		return 1
+	}
+
+	return 0
+}
+
+func comparePrerelease(a string, b string) int {
+	if a == b {
+		return 0
+	}
+
+	if a == "" {
+		return 1
+	}
+
+	if b == "" {
+		return -1
+	}
+
+	partsA := strings.Split(a, ".")
+	partsB := strings.Split(b, ".")
+
+	for i := 0; i < len(partsA) && i < len(partsB); i++ {
+		if partsA[i] == partsB[i] {
+			continue
+		}
+
+		numberA, errA := strconv.ParseInt(partsA[i], 10, 64)
+		numberB, errB := strconv.ParseInt(partsB[i], 10, 64)
+
+		switch {
+		case errA == nil && errB == nil:
+			return compareInts(numberA, numberB)
+		case errA == nil:
+			return -1
+		case errB == nil:
+			return 1
+		case partsA[i] < partsB[i]:
+			return -1
+		default:
+			return 1
+		}
+	}
+
+	return compareInts(int64(len(partsA)), int64(len(partsB)))
+}
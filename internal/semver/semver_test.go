@@ -0,0 +1,98 @@
+package semver
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Version
+	}{
+		{value: "1.2.3", want: Version{Major: 1, Minor: 2, Patch: 3}},
+		{value: "v0.7.1", want: Version{Minor: 7, Patch: 1}},
+		{value: " 1.2 ", want: Version{Major: 1, Minor: 2}},
+		{value: "2", want: Version{Major: 2}},
+		{value: "1.0.0-rc.1", want: Version{Major: 1, Prerelease: "rc.1"}},
+		{value: "1.0.0+build.5", want: Version{Major: 1}},
+		{value: "1.0.0-beta+exp.sha.5114f85", want: Version{Major: 1, Prerelease: "beta"}},
+	}
+
+	for _, test := range tests {
+		version, err := Parse(test.value)
+		if err != nil || version != test.want {
+			t.Errorf("Parse(%q) = %+v, %v, want %+v", test.value, version, err, test.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, value := range []string{"", "v", "1.2.3.4", "1..3", "1.x.3", "-1.2.3", "1.-2.3", "latest"} {
+		if version, err := Parse(value); err == nil {
+			t.Errorf("Parse(%q) = %+v, want an error", value, version)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// Ordered as in the precedence example of the semver 2.0.0 specification, followed by releases.
+	ordered := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.2.0",
+		"1.10.0",
+		"2.0.0",
+	}
+
+	for i := range ordered {
+		for j := range ordered {
+			a, err := Parse(ordered[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := Parse(ordered[j])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := compareInts(int64(i), int64(j))
+			if got := a.Compare(b); got != want {
+				t.Errorf("%s.Compare(%s) = %d, want %d", ordered[i], ordered[j], got, want)
+			}
+		}
+	}
+}
+
+func TestCompareIgnoresBuildMetadata(t *testing.T) {
+	a, _ := Parse("v1.2.3+linux")
+	b, _ := Parse("1.2.3+darwin")
+
+	if a.Compare(b) != 0 {
+		t.Errorf("%s.Compare(%s) = %d, want 0", a, b, a.Compare(b))
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := map[string]string{
+		"v1.2":          "1.2.0",
+		"0.7.1":         "0.7.1",
+		"1.0.0-rc.1+b2": "1.0.0-rc.1",
+	}
+
+	for value, want := range tests {
+		version, err := Parse(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if version.String() != want {
+			t.Errorf("Parse(%q).String() = %q, want %q", value, version.String(), want)
+		}
+	}
+}
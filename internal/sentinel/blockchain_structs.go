@@ -1,6 +1,11 @@
 package sentinel
 
-import "time"
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type SentinelError struct {
 	Code    int64  `json:"code"`
@@ -27,6 +32,23 @@ type SentinelTransaction struct {
 	TxResult SentinelTransactionResult `json:"tx_result"`
 }
 
+// SubscriptionID returns the ID of the subscription created by the transaction.
+func (t SentinelTransaction) SubscriptionID() (int64, error) {
+	for _, event := range t.TxResult.Events {
+		if !strings.HasSuffix(event.Type, "EventCreateSubscription") {
+			continue
+		}
+
+		for _, attribute := range event.Attributes {
+			if attribute.Key == "id" {
+				return strconv.ParseInt(strings.Trim(attribute.Value, `"`), 10, 64)
+			}
+		}
+	}
+
+	return 0, errors.New("no subscription created in transaction " + t.TxHash)
+}
+
 type SentinelAllowanceDetails struct {
 	Expiration *time.Time `json:"expiration"`
 }
@@ -36,3 +58,17 @@ type SentinelAllowance struct {
 	Grantee   string                   `json:"grantee"`
 	Granter   string                   `json:"granter"`
 }
+
+type SentinelCoin struct {
+	Denom  string `json:"denom"`
+	Amount string `json:"amount"`
+}
+
+// FeeAllowance describes the allowance wrapped in an AllowedMsgAllowance. A periodic allowance is
+// granted when Period is set, a basic allowance otherwise. Empty limits are unlimited.
+type FeeAllowance struct {
+	SpendLimit       string     `json:"spend_limit,omitempty"`
+	Expiration       *time.Time `json:"expiration,omitempty"`
+	Period           int64      `json:"period,omitempty"`
+	PeriodSpendLimit string     `json:"period_spend_limit,omitempty"`
+}
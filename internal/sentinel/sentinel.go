@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 )
 
 type Sentinel struct {
@@ -74,7 +75,52 @@ func (s Sentinel) FetchFeeGrantAllowances(walletAddress string, limit int, offse
 	return response.Result, nil
 }
 
-func (s Sentinel) GrantFeeToWallet(walletAddresses []string) error {
+func (s Sentinel) FetchBalances(walletAddress string) (*[]SentinelCoin, error) {
+	type blockchainResponse struct {
+		Success bool            `json:"success"`
+		Error   *SentinelError  `json:"error"`
+		Result  *[]SentinelCoin `json:"result"`
+	}
+
+	args := fmt.Sprintf(
+		"?rpc_address=%s&chain_id=%s",
+		s.RPCEndpoint,
+		s.ChainID,
+	)
+
+	url := s.APIEndpoint + "/api/v1/balances/" + walletAddress + args
+	req, _ := http.NewRequest("GET", url, nil)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var response *blockchainResponse
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Success == false {
+		apiError := ""
+		if response.Error != nil {
+			apiError = " (" + response.Error.Message + ")"
+		}
+
+		return nil, errors.New("success `false` returned from Sentinel API when fetching balances" + apiError)
+	}
+
+	return response.Result, nil
+}
+
+func (s Sentinel) GrantFeeToWallet(walletAddresses []string, allowance FeeAllowance) error {
 	type blockchainResponse struct {
 		Success bool                 `json:"success"`
 		Error   *SentinelError       `json:"error"`
@@ -85,12 +131,15 @@ func (s Sentinel) GrantFeeToWallet(walletAddresses []string) error {
 		Mnemonic     string   `json:"mnemonic"`
 		AccAddresses []string `json:"acc_addresses"`
 		AllowedMsgs  []string `json:"allowed_msgs"`
+
+		FeeAllowance
 	}
 
 	payload, err := json.Marshal(blockchainRequest{
 		Mnemonic:     s.FeeGranterMnemonic,
 		AccAddresses: walletAddresses,
 		AllowedMsgs:  []string{"/sentinel.plan.v2.MsgSubscribeRequest", "/sentinel.session.v2.MsgStartRequest", "/sentinel.session.v2.MsgEndRequest"},
+		FeeAllowance: allowance,
 	})
 
 	if err != nil {
@@ -141,6 +190,208 @@ func (s Sentinel) GrantFeeToWallet(walletAddresses []string) error {
 	return nil
 }
 
+func (s Sentinel) RevokeFeeFromWallets(walletAddresses []string) error {
+	type blockchainResponse struct {
+		Success bool                 `json:"success"`
+		Error   *SentinelError       `json:"error"`
+		Result  *SentinelTransaction `json:"result"`
+	}
+
+	type blockchainRequest struct {
+		Mnemonic     string   `json:"mnemonic"`
+		AccAddresses []string `json:"acc_addresses"`
+	}
+
+	payload, err := json.Marshal(blockchainRequest{
+		Mnemonic:     s.FeeGranterMnemonic,
+		AccAddresses: walletAddresses,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	gas := s.GasBase * int64(len(walletAddresses)+1)
+
+	args := fmt.Sprintf(
+		"?rpc_address=%s&chain_id=%s&gas_prices=%s&gas=%d&simulate_and_execute=false",
+		s.RPCEndpoint,
+		s.ChainID,
+		s.GasPrice+s.DefaultDenom,
+		gas,
+	)
+
+	url := s.APIEndpoint + "/api/v1/feegrants" + args
+	req, _ := http.NewRequest("DELETE", url, bytes.NewBuffer(payload))
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	var response *blockchainResponse
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return err
+	}
+
+	if response.Success == false {
+		apiError := ""
+		if response.Error != nil {
+			apiError = " (" + response.Error.Message + ")"
+		}
+
+		return errors.New("success `false` returned from Sentinel API while revoking fee from wallets" + apiError)
+	}
+
+	return nil
+}
+
+// SubscribeToPlan subscribes the fee granter to the provider plan and returns the subscription ID.
+func (s Sentinel) SubscribeToPlan(denom string) (int64, error) {
+	type blockchainResponse struct {
+		Success bool                 `json:"success"`
+		Error   *SentinelError       `json:"error"`
+		Result  *SentinelTransaction `json:"result"`
+	}
+
+	type blockchainRequest struct {
+		Mnemonic string `json:"mnemonic"`
+		Denom    string `json:"denom"`
+	}
+
+	payload, err := json.Marshal(blockchainRequest{
+		Mnemonic: s.FeeGranterMnemonic,
+		Denom:    denom,
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	args := fmt.Sprintf(
+		"?rpc_address=%s&chain_id=%s&gas_prices=%s&gas=%d&simulate_and_execute=false",
+		s.RPCEndpoint,
+		s.ChainID,
+		s.GasPrice+s.DefaultDenom,
+		s.GasBase*2,
+	)
+
+	url := s.APIEndpoint + "/api/v1/plans/" + s.ProviderPlanBlockchainID + "/subscriptions" + args
+	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(payload))
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	defer res.Body.Close()
+
+	var response *blockchainResponse
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return 0, err
+	}
+
+	if response.Success == false {
+		apiError := ""
+		if response.Error != nil {
+			apiError = " (" + response.Error.Message + ")"
+		}
+
+		return 0, errors.New("success `false` returned from Sentinel API while subscribing to plan" + apiError)
+	}
+
+	if response.Result == nil {
+		return 0, errors.New("no transaction returned from Sentinel API while subscribing to plan")
+	}
+
+	return response.Result.SubscriptionID()
+}
+
+// AllocateSubscription shares the given number of bytes of a subscription owned by the fee granter
+// with each wallet.
+func (s Sentinel) AllocateSubscription(subscriptionId int64, walletAddresses []string, bytesPerWallet string) error {
+	type blockchainResponse struct {
+		Success bool                 `json:"success"`
+		Error   *SentinelError       `json:"error"`
+		Result  *SentinelTransaction `json:"result"`
+	}
+
+	type blockchainRequest struct {
+		Mnemonic     string   `json:"mnemonic"`
+		AccAddresses []string `json:"acc_addresses"`
+		Bytes        string   `json:"bytes"`
+	}
+
+	payload, err := json.Marshal(blockchainRequest{
+		Mnemonic:     s.FeeGranterMnemonic,
+		AccAddresses: walletAddresses,
+		Bytes:        bytesPerWallet,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	gas := s.GasBase * int64(len(walletAddresses)+1)
+
+	args := fmt.Sprintf(
+		"?rpc_address=%s&chain_id=%s&gas_prices=%s&gas=%d&simulate_and_execute=false",
+		s.RPCEndpoint,
+		s.ChainID,
+		s.GasPrice+s.DefaultDenom,
+		gas,
+	)
+
+	url := s.APIEndpoint + "/api/v1/subscriptions/" + strconv.FormatInt(subscriptionId, 10) + "/allocations" + args
+	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(payload))
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	var response *blockchainResponse
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return err
+	}
+
+	if response.Success == false {
+		apiError := ""
+		if response.Error != nil {
+			apiError = " (" + response.Error.Message + ")"
+		}
+
+		return errors.New("success `false` returned from Sentinel API while allocating subscription" + apiError)
+	}
+
+	return nil
+}
+
 func (s Sentinel) SendTokensToWallet(walletAddresses []string, amounts []string) error {
 	type blockchainResponse struct {
 		Success bool                 `json:"success"`
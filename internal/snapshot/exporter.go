@@ -0,0 +1,295 @@
+package snapshot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"dvpn/models"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"gorm.io/gorm"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	EncodingGzip = "gzip"
+	EncodingZstd = "zstd"
+
+	manifestKey = "latest.json"
+)
+
+type Manifest struct {
+	Revision    int64     `json:"revision"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Key         string    `json:"key"`
+	Encoding    string    `json:"encoding"`
+	SHA256      string    `json:"sha256"`
+	Signature   string    `json:"signature"`
+	History     []string  `json:"history"`
+}
+
+type Catalog struct {
+	Revision    int64            `json:"revision"`
+	GeneratedAt time.Time        `json:"generated_at"`
+	Countries   []models.Country `json:"countries"`
+	Cities      []models.City    `json:"cities"`
+	Servers     []models.Server  `json:"servers"`
+}
+
+type Exporter struct {
+	DB         *gorm.DB
+	Store      Store
+	SigningKey ed25519.PrivateKey
+	Encoding   string
+	Retain     int
+
+	// CacheTTL bounds how long the latest snapshot is served from memory before it is reloaded
+	// from the store, to pick up snapshots exported by other instances.
+	CacheTTL time.Duration
+
+	mu            sync.RWMutex
+	loadedAt      time.Time
+	latest        *Manifest
+	latestData    []byte
+	latestDecoded []byte
+}
+
+func ParseSigningKey(value string) (ed25519.PrivateKey, error) {
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("invalid catalog signing key: " + err.Error())
+	}
+
+	switch len(key) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(key), nil
+	default:
+		return nil, errors.New("catalog signing key must be a base64 ed25519 seed or private key")
+	}
+}
+
+func (e *Exporter) Export(revision int64) (*Manifest, error) {
+	catalog, err := e.buildCatalog(revision)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(catalog)
+	if err != nil {
+		return nil, err
+	}
+
+	compressed, err := Compress(e.Encoding, data)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(data)
+	key := fmt.Sprintf("catalog-%d.json.%s", revision, extension(e.Encoding))
+
+	err = e.Store.Put(key, compressed, "application/octet-stream")
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := Manifest{
+		Revision:    revision,
+		GeneratedAt: catalog.GeneratedAt,
+		Key:         key,
+		Encoding:    e.Encoding,
+		SHA256:      hex.EncodeToString(hash[:]),
+		Signature:   base64.StdEncoding.EncodeToString(ed25519.Sign(e.SigningKey, data)),
+	}
+
+	previous, err := e.manifest()
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	var expired []string
+	if previous != nil {
+		manifest.History = append([]string{previous.Key}, previous.History...)
+		if e.Retain > 0 && len(manifest.History) > e.Retain {
+			expired = manifest.History[e.Retain:]
+			manifest.History = manifest.History[:e.Retain]
+		}
+	}
+
+	manifestData, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	err = e.Store.Put(manifestKey, manifestData, "application/json")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range expired {
+		if key != manifest.Key {
+			_ = e.Store.Delete(key)
+		}
+	}
+
+	e.cache(&manifest, compressed, data)
+
+	return &manifest, nil
+}
+
+// Latest returns the manifest of the latest snapshot with its compressed and decompressed data,
+// from memory unless the cached copy is older than CacheTTL.
+func (e *Exporter) Latest() (*Manifest, []byte, []byte, error) {
+	e.mu.RLock()
+	manifest, data, decoded := e.latest, e.latestData, e.latestDecoded
+	isFresh := manifest != nil && time.Since(e.loadedAt) < e.CacheTTL
+	e.mu.RUnlock()
+
+	if isFresh {
+		return manifest, data, decoded, nil
+	}
+
+	manifest, err := e.manifest()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	data, err = e.Store.Get(manifest.Key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	decoded, err = Decompress(manifest.Encoding, data)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	e.cache(manifest, data, decoded)
+
+	return manifest, data, decoded, nil
+}
+
+func (e *Exporter) cache(manifest *Manifest, data []byte, decoded []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.latest = manifest
+	e.latestData = data
+	e.latestDecoded = decoded
+	e.loadedAt = time.Now()
+}
+
+func (e *Exporter) manifest() (*Manifest, error) {
+	data, err := e.Store.Get(manifestKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &manifest, nil
+}
+
+func (e *Exporter) buildCatalog(revision int64) (*Catalog, error) {
+	catalog := Catalog{
+		Revision:    revision,
+		GeneratedAt: time.Now().UTC(),
+	}
+
+	tx := e.DB.Raw("SELECT c.id, c.created_at, c.updated_at, c.name, c.code, COUNT(s.id) as servers_available FROM countries AS c INNER JOIN servers AS s ON s.country_id = c.id WHERE s.is_active = true AND s.is_banned = false AND s.is_version_supported = true GROUP BY c.id ORDER BY c.name").Scan(&catalog.Countries)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	tx = e.DB.Raw("SELECT c.id, c.created_at, c.updated_at, c.country_id, c.name, COUNT(s.id) as servers_available FROM cities AS c INNER JOIN servers AS s ON s.city_id = c.id WHERE s.is_active = true AND s.is_banned = false AND s.is_version_supported = true GROUP BY c.id ORDER BY c.country_id, servers_available DESC").Scan(&catalog.Cities)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	tx = e.DB.Model(&models.Server{}).Preload("Reliability").Where("is_active = ? AND is_banned = ? AND is_version_supported = ?", true, false, true).Order("id").Find(&catalog.Servers)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	return &catalog, nil
+}
+
+func Compress(encoding string, data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	switch encoding {
+	case EncodingGzip:
+		writer, err := gzip.NewWriterLevel(&buffer, gzip.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := writer.Write(data); err != nil {
+			return nil, err
+		}
+
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+	case EncodingZstd:
+		writer, err := zstd.NewWriter(&buffer, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := writer.Write(data); err != nil {
+			return nil, err
+		}
+
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("unsupported catalog encoding " + encoding)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func Decompress(encoding string, data []byte) ([]byte, error) {
+	switch encoding {
+	case EncodingGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+
+		return io.ReadAll(reader)
+	case EncodingZstd:
+		reader, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+
+		return io.ReadAll(reader)
+	default:
+		return nil, errors.New("unsupported catalog encoding " + encoding)
+	}
+}
+
+func extension(encoding string) string {
+	if encoding == EncodingZstd {
+		return "zst"
+	}
+
+	return "gz"
+}
@@ -0,0 +1,53 @@
+package snapshot
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+var ErrNotFound = errors.New("snapshot object not found")
+
+type Store interface {
+	Put(key string, data []byte, contentType string) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+type DiskStore struct {
+	Directory string
+}
+
+func (s DiskStore) Put(key string, data []byte, contentType string) error {
+	err := os.MkdirAll(s.Directory, 0755)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.Directory, filepath.Base(key))
+
+	err = os.WriteFile(path+".tmp", data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+func (s DiskStore) Get(key string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.Directory, filepath.Base(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	return data, err
+}
+
+func (s DiskStore) Delete(key string) error {
+	err := os.Remove(filepath.Join(s.Directory, filepath.Base(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,68 @@
+package versionpolicy
+
+import (
+	"dvpn/internal/semver"
+	"dvpn/models"
+	"strings"
+)
+
+type Rule struct {
+	MinVersion      *semver.Version
+	BlockedVersions []semver.Version
+}
+
+type Policy struct {
+	Rules map[models.ServerProtocol]Rule
+}
+
+func ParseRule(minVersion string, blockedVersions string) (Rule, error) {
+	var rule Rule
+
+	if strings.TrimSpace(minVersion) != "" {
+		version, err := semver.Parse(minVersion)
+		if err != nil {
+			return rule, err
+		}
+
+		rule.MinVersion = &version
+	}
+
+	for _, part := range strings.Split(blockedVersions, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+
+		version, err := semver.Parse(part)
+		if err != nil {
+			return rule, err
+		}
+
+		rule.BlockedVersions = append(rule.BlockedVersions, version)
+	}
+
+	return rule, nil
+}
+
+func (p Policy) IsSupported(protocol models.ServerProtocol, version string) (bool, string) {
+	rule, ok := p.Rules[protocol]
+	if !ok || (rule.MinVersion == nil && len(rule.BlockedVersions) == 0) {
+		return true, ""
+	}
+
+	parsed, err := semver.Parse(version)
+	if err != nil {
+		return false, "unparseable version " + version
+	}
+
+	if rule.MinVersion != nil && parsed.Compare(*rule.MinVersion) < 0 {
+		return false, "version " + parsed.String() + " is below minimum " + rule.MinVersion.String()
+	}
+
+	for _, blocked := range rule.BlockedVersions {
+		if parsed.Compare(blocked) == 0 {
+			return false, "version " + parsed.String() + " is blocked"
+		}
+	}
+
+	return true, ""
+}
@@ -0,0 +1,31 @@
+package walletauth
+
+import (
+	"crypto/sha256"
+	"dvpn/models"
+	"encoding/hex"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SignatureStore struct {
+	DB *gorm.DB
+}
+
+// Claim records the signature as used until expiresAt. It returns false if the signature was
+// already used.
+func (s *SignatureStore) Claim(signature []byte, expiresAt time.Time) (bool, error) {
+	hash := sha256.Sum256(signature)
+
+	tx := s.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.UsedWalletSignature{
+		Hash:      hex.EncodeToString(hash[:]),
+		ExpiresAt: expiresAt,
+	})
+	if tx.Error != nil {
+		return false, tx.Error
+	}
+
+	return tx.RowsAffected == 1, nil
+}
@@ -0,0 +1,111 @@
+package walletauth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"dvpn/internal/bech32"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"golang.org/x/crypto/ripemd160"
+)
+
+func AddressFromPublicKey(hrp string, publicKey []byte) (string, error) {
+	if _, err := secp256k1.ParsePubKey(publicKey); err != nil {
+		return "", err
+	}
+
+	shaHash := sha256.Sum256(publicKey)
+
+	hasher := ripemd160.New()
+	hasher.Write(shaHash[:])
+
+	return bech32.Encode(hrp, hasher.Sum(nil))
+}
+
+// VerifyADR036 checks a signature produced by signArbitrary in Keplr-compatible wallets,
+// which sign an amino JSON StdSignDoc wrapping a single sign/MsgSignData message.
+func VerifyADR036(publicKey []byte, signature []byte, signer string, data []byte) error {
+	key, err := secp256k1.ParsePubKey(publicKey)
+	if err != nil {
+		return errors.New("invalid public key: " + err.Error())
+	}
+
+	if len(signature) != 64 {
+		return errors.New("invalid signature length")
+	}
+
+	var r, s secp256k1.ModNScalar
+	if r.SetByteSlice(signature[:32]) || s.SetByteSlice(signature[32:]) {
+		return errors.New("invalid signature")
+	}
+
+	// Both (r, s) and (r, n-s) verify; accepting only the low-S form keeps each signed
+	// message to a single signature encoding, as the Cosmos SDK does.
+	if s.IsOverHalfOrder() {
+		return errors.New("non-canonical signature")
+	}
+
+	signDoc, err := adr036SignDoc(signer, data)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.Sum256(signDoc)
+	if !ecdsa.NewSignature(&r, &s).Verify(hash[:], key) {
+		return errors.New("signature verification failed")
+	}
+
+	return nil
+}
+
+func adr036SignDoc(signer string, data []byte) ([]byte, error) {
+	type coin struct {
+		Amount string `json:"amount"`
+		Denom  string `json:"denom"`
+	}
+
+	type fee struct {
+		Amount []coin `json:"amount"`
+		Gas    string `json:"gas"`
+	}
+
+	type msgValue struct {
+		Data   string `json:"data"`
+		Signer string `json:"signer"`
+	}
+
+	type msg struct {
+		Type  string   `json:"type"`
+		Value msgValue `json:"value"`
+	}
+
+	type signDoc struct {
+		AccountNumber string `json:"account_number"`
+		ChainID       string `json:"chain_id"`
+		Fee           fee    `json:"fee"`
+		Memo          string `json:"memo"`
+		Msgs          []msg  `json:"msgs"`
+		Sequence      string `json:"sequence"`
+	}
+
+	return json.Marshal(signDoc{
+		AccountNumber: "0",
+		Fee: fee{
+			Amount: []coin{},
+			Gas:    "0",
+		},
+		Msgs: []msg{
+			{
+				Type: "sign/MsgSignData",
+				Value: msgValue{
+					Data:   base64.StdEncoding.EncodeToString(data),
+					Signer: signer,
+				},
+			},
+		},
+		Sequence: "0",
+	})
+}
@@ -0,0 +1,106 @@
+package walletauth
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+const (
+	testPublicKey = "A/lzoLhwYsOJ0SXYGZ6AO4Mrasa/eGek9s2HUGBg/ExY"
+	testSigner    = "sent1ptqd6902tgrvl5zsj2dm5q4hvvdajh35f59dur"
+)
+
+func decode(t *testing.T, s string) []byte {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// highS returns the (r, n-s) form of a low-S r||s signature, which verifies against the same hash.
+func highS(signature []byte) []byte {
+	var s secp256k1.ModNScalar
+	s.SetByteSlice(signature[32:])
+	s.Negate()
+
+	encoded := s.Bytes()
+	return append(append([]byte{}, signature[:32]...), encoded[:]...)
+}
+
+func TestAddressFromPublicKey(t *testing.T) {
+	tests := []struct {
+		hrp       string
+		publicKey string
+		address   string
+	}{
+		// The compressed generator point, whose HASH160 is the program of the first BIP-173 address.
+		{"sent", "Anm+Zn753LusVaBilc6HCwcCm/zbLc4o2VnygVsW+BeY", "sent1w508d6qejxtdg4y5r3zarvary0c5xw7kpxprth"},
+		{"cosmos", "Anm+Zn753LusVaBilc6HCwcCm/zbLc4o2VnygVsW+BeY", "cosmos1w508d6qejxtdg4y5r3zarvary0c5xw7k6ah60c"},
+		{"sent", testPublicKey, testSigner},
+	}
+
+	for _, test := range tests {
+		address, err := AddressFromPublicKey(test.hrp, decode(t, test.publicKey))
+		if err != nil || address != test.address {
+			t.Errorf("AddressFromPublicKey(%q, %s) = %q, %v, want %q", test.hrp, test.publicKey, address, err, test.address)
+		}
+	}
+
+	_, err := AddressFromPublicKey("sent", []byte{2, 1, 2, 3})
+	if err == nil {
+		t.Error("AddressFromPublicKey accepted an invalid public key")
+	}
+}
+
+func TestADR036SignDoc(t *testing.T) {
+	want := `{"account_number":"0","chain_id":"","fee":{"amount":[],"gas":"0"},"memo":"","msgs":[{"type":"sign/MsgSignData","value":{"data":"aGVsbG8=","signer":"` + testSigner + `"}}],"sequence":"0"}`
+
+	signDoc, err := adr036SignDoc(testSigner, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(signDoc) != want {
+		t.Errorf("adr036SignDoc() = %s, want %s", signDoc, want)
+	}
+}
+
+func TestVerifyADR036(t *testing.T) {
+	const (
+		helloSignature = "k1pr2c4Zs+9vYPLSv4bw6ktt8y3U2Qifjgph6vwnEtgIkyLYACp7TQU+cE7/vOQUAlfI3gp66UFCWL4RCPjIXQ=="
+		emptySignature = "dtL98TAtH6lVb035TshM77ptSC5U9HxsKiOMG6pWDw4jd5XAndkP+p3xFqqftF1BU+u5Au1ifg0zQD/J1Slhkg=="
+	)
+
+	tests := []struct {
+		name      string
+		publicKey string
+		signature []byte
+		signer    string
+		data      string
+		valid     bool
+	}{
+		{"valid", testPublicKey, decode(t, helloSignature), testSigner, "hello", true},
+		{"valid empty data", testPublicKey, decode(t, emptySignature), testSigner, "", true},
+		{"different data", testPublicKey, decode(t, helloSignature), testSigner, "hellO", false},
+		{"different signer", testPublicKey, decode(t, helloSignature), "sent1w508d6qejxtdg4y5r3zarvary0c5xw7kpxprth", "hello", false},
+		{"different key", "Anm+Zn753LusVaBilc6HCwcCm/zbLc4o2VnygVsW+BeY", decode(t, helloSignature), testSigner, "hello", false},
+		{"swapped signature", testPublicKey, decode(t, emptySignature), testSigner, "hello", false},
+		{"high-S signature", testPublicKey, highS(decode(t, helloSignature)), testSigner, "hello", false},
+		{"short signature", testPublicKey, decode(t, helloSignature)[:63], testSigner, "hello", false},
+	}
+
+	for _, test := range tests {
+		err := VerifyADR036(decode(t, test.publicKey), test.signature, test.signer, []byte(test.data))
+		if test.valid && err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+		}
+
+		if !test.valid && err == nil {
+			t.Errorf("%s: signature accepted", test.name)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package jobs
+
+import (
+	"dvpn/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math"
+	"time"
+)
+
+const (
+	connectionReportsWindow    = 7 * 24 * time.Hour
+	connectionReportsRetention = 30 * 24 * time.Hour
+)
+
+type AggregateConnectionReports struct {
+	DB     *gorm.DB
+	Logger *zap.SugaredLogger
+}
+
+func (job AggregateConnectionReports) Run() {
+	type aggregate struct {
+		ServerID          uint
+		Reports           int64
+		Successes         int64
+		AvgHandshakeMs    *float64
+		AvgThroughputKbps *float64
+	}
+
+	var aggregates []aggregate
+	tx := job.DB.Raw("SELECT server_id, COUNT(*) AS reports, COUNT(*) FILTER (WHERE is_successful) AS successes, AVG(handshake_ms) FILTER (WHERE is_successful) AS avg_handshake_ms, AVG(throughput_kbps) FILTER (WHERE is_successful) AS avg_throughput_kbps FROM connection_reports WHERE created_at > ? GROUP BY server_id", time.Now().Add(-connectionReportsWindow)).Scan(&aggregates)
+	if tx.Error != nil {
+		job.Logger.Error("failed to aggregate connection reports: " + tx.Error.Error())
+		return
+	}
+
+	var reliabilities []models.ServerReliability
+	var serverIds []uint
+
+	for _, a := range aggregates {
+		successRate := float64(a.Successes) / float64(a.Reports)
+
+		reliabilities = append(reliabilities, models.ServerReliability{
+			ServerID:          a.ServerID,
+			Reports:           a.Reports,
+			SuccessRate:       successRate,
+			Score:             wilsonLowerBound(a.Successes, a.Reports),
+			AvgHandshakeMs:    a.AvgHandshakeMs,
+			AvgThroughputKbps: a.AvgThroughputKbps,
+		})
+		serverIds = append(serverIds, a.ServerID)
+	}
+
+	if len(reliabilities) > 0 {
+		tx = job.DB.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "server_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"reports", "success_rate", "score", "avg_handshake_ms", "avg_throughput_kbps", "updated_at"}),
+		}).CreateInBatches(&reliabilities, 500)
+		if tx.Error != nil {
+			job.Logger.Error("failed to save server reliabilities: " + tx.Error.Error())
+			return
+		}
+	}
+
+	tx = job.DB.Where("server_id NOT IN ?", append(serverIds, 0)).Delete(&models.ServerReliability{})
+	if tx.Error != nil {
+		job.Logger.Error("failed to delete stale server reliabilities: " + tx.Error.Error())
+	}
+
+	tx = job.DB.Where("created_at < ?", time.Now().Add(-connectionReportsRetention)).Delete(&models.ConnectionReport{})
+	if tx.Error != nil {
+		job.Logger.Error("failed to delete old connection reports: " + tx.Error.Error())
+	}
+
+	job.Logger.Infof("aggregated connection reports for %d servers", len(reliabilities))
+}
+
+func wilsonLowerBound(successes int64, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	const z = 1.96
+
+	n := float64(total)
+	p := float64(successes) / n
+
+	return (p + z*z/(2*n) - z*math.Sqrt((p*(1-p)+z*z/(4*n))/n)) / (1 + z*z/n)
+}
@@ -1,6 +1,7 @@
 package jobs
 
 import (
+	"dvpn/internal/feegrant"
 	"dvpn/internal/sentinel"
 	"dvpn/models"
 	"go.uber.org/zap"
@@ -11,108 +12,76 @@ type EnrollWallets struct {
 	DB       *gorm.DB
 	Logger   *zap.SugaredLogger
 	Sentinel *sentinel.Sentinel
+	Policies *feegrant.Policies
+	Trial    *TrialPolicy
 }
 
 func (job EnrollWallets) Run() {
 	var wallets []models.Wallet
 
-	tx := job.DB.Model(&models.Wallet{}).Order("id desc").Limit(1000).Where("is_fee_granted = FALSE").Find(&wallets)
+	tx := job.DB.Model(&models.Wallet{}).Order("id desc").Limit(1000).Where("is_fee_granted = FALSE AND fee_grant_revoked_at IS NULL AND deregistered_at IS NULL").Find(&wallets)
 	if tx.Error != nil {
 		job.Logger.Error("failed to get Sentinel wallets from the DB: " + tx.Error.Error())
 		return
 	}
 
-	chunks := job.formChunks(wallets, 100)
+	chunks := chunk(wallets, 100)
 	for _, chunk := range chunks {
 
-		var walletsForGrantingFee []string
+		var walletsForGrantingFee []models.Wallet
+		var walletsToSave []models.Wallet
 
 		for _, wallet := range chunk {
-			existingAllowances, err := job.fetchAllowances(wallet.Address)
+			existingAllowances, err := fetchAllowances(job.Sentinel, wallet.Address)
 			if err != nil {
 				job.Logger.Errorf("failed to fetch existing grant fee allowances from Sentinel for wallet %s: "+err.Error(), wallet.Address)
 				continue
 			}
 
-			isDeviceAlreadyGrantedWithFee := false
-
-			if len(*existingAllowances) > 0 {
-				for _, allowance := range *existingAllowances {
-					if allowance.Grantee == wallet.Address && allowance.Granter == job.Sentinel.FeeGranterWalletAddress {
-						isDeviceAlreadyGrantedWithFee = true
-					}
-				}
-			}
-
-			if isDeviceAlreadyGrantedWithFee == false {
-				walletsForGrantingFee = append(walletsForGrantingFee, wallet.Address)
+			allowance := findAllowance(existingAllowances, wallet.Address, job.Sentinel.FeeGranterWalletAddress)
+			if allowance == nil {
+				walletsForGrantingFee = append(walletsForGrantingFee, wallet)
+			} else {
+				wallet.IsFeeGranted = true
+				wallet.FeeGrantExpiresAt = allowance.Allowance.Expiration
+				walletsToSave = append(walletsToSave, wallet)
 			}
 		}
 
+		var granted []models.Wallet
 		if len(walletsForGrantingFee) > 0 {
-			err := job.Sentinel.GrantFeeToWallet(walletsForGrantingFee)
+			walletsForGrantingFee, err := excludeDeregistered(job.DB, walletsForGrantingFee)
 			if err != nil {
-				job.Logger.Error("failed to grant fee to existing Sentinel wallets: " + err.Error())
+				job.Logger.Error("failed to check wallets for deregistration: " + err.Error())
 				continue
 			}
-		}
-
-		var walletsToSave []models.Wallet
 
-		for _, wallet := range chunk {
-			wallet.IsFeeGranted = true
-			walletsToSave = append(walletsToSave, wallet)
+			granted, err = grantFeeByTier(job.Sentinel, job.Policies, walletsForGrantingFee)
+			if err != nil {
+				job.Logger.Error("failed to grant fee to existing Sentinel wallets: " + err.Error())
+			}
 		}
 
-		if len(walletsToSave) > 0 {
-			tx = job.DB.Save(&walletsToSave)
-			if tx.Error != nil {
-				job.Logger.Error("failed to update existing wallets: " + tx.Error.Error())
+		var grantedAndSaved []models.Wallet
+		for i, wallet := range append(walletsToSave, granted...) {
+			isSaved, err := saveGrantedWallet(job.DB, wallet, map[string]interface{}{
+				"is_fee_granted":       wallet.IsFeeGranted,
+				"fee_grant_policy":     wallet.FeeGrantPolicy,
+				"fee_grant_expires_at": wallet.FeeGrantExpiresAt,
+			})
+			if err != nil {
+				job.Logger.Error("failed to update existing wallets: " + err.Error())
 				continue
 			}
-		}
 
-	}
-}
-
-func (job EnrollWallets) formChunks(wallets []models.Wallet, chunkSize int) [][]models.Wallet {
-	var chunks [][]models.Wallet
-	for chunkSize < len(wallets) {
-		wallets, chunks = wallets[chunkSize:], append(chunks, wallets[0:chunkSize:chunkSize])
-	}
-	chunks = append(chunks, wallets)
-	return chunks
-}
-
-func (job EnrollWallets) fetchAllowances(walletAddress string) (*[]sentinel.SentinelAllowance, error) {
-	var syncInProgress bool
-	var limit int
-	var offset int
-
-	syncInProgress = true
-	limit = 10000
-	offset = 0
-
-	var allowances []sentinel.SentinelAllowance
-
-	for syncInProgress {
-		n, err := job.Sentinel.FetchFeeGrantAllowances(walletAddress, limit, offset)
-		if err != nil {
-			return nil, err
-		}
-
-		if n == nil {
-			syncInProgress = false
-		} else {
-			if len(*n) < limit {
-				syncInProgress = false
+			if !isSaved {
+				job.Logger.Warnf("wallet %s was deregistered while its fee grant was enrolled, queued its revocation again", wallet.Address)
+			} else if i >= len(walletsToSave) {
+				grantedAndSaved = append(grantedAndSaved, wallet)
 			}
-
-			allowances = append(allowances, *n...)
 		}
 
-		offset += limit
-	}
+		queueTrialGrants(job.DB, job.Logger, job.Trial, grantedAndSaved)
 
-	return &allowances, nil
+	}
 }
@@ -0,0 +1,159 @@
+package jobs
+
+import (
+	"dvpn/internal/feegrant"
+	"dvpn/internal/sentinel"
+	"dvpn/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// chunk splits values into consecutive chunks of at most size values, sharing their backing array.
+func chunk[T any](values []T, size int) [][]T {
+	var chunks [][]T
+	for size < len(values) {
+		values, chunks = values[size:], append(chunks, values[0:size:size])
+	}
+	chunks = append(chunks, values)
+	return chunks
+}
+
+func fetchAllowances(s *sentinel.Sentinel, walletAddress string) (*[]sentinel.SentinelAllowance, error) {
+	var syncInProgress bool
+	var limit int
+	var offset int
+
+	syncInProgress = true
+	limit = 10000
+	offset = 0
+
+	var allowances []sentinel.SentinelAllowance
+
+	for syncInProgress {
+		n, err := s.FetchFeeGrantAllowances(walletAddress, limit, offset)
+		if err != nil {
+			return nil, err
+		}
+
+		if n == nil {
+			syncInProgress = false
+		} else {
+			if len(*n) < limit {
+				syncInProgress = false
+			}
+
+			allowances = append(allowances, *n...)
+		}
+
+		offset += limit
+	}
+
+	return &allowances, nil
+}
+
+func findAllowance(allowances *[]sentinel.SentinelAllowance, grantee string, granter string) *sentinel.SentinelAllowance {
+	for _, allowance := range *allowances {
+		if allowance.Grantee == grantee && allowance.Granter == granter {
+			return &allowance
+		}
+	}
+
+	return nil
+}
+
+// grantFeeByTier grants each wallet the allowance policy of its tier and records the policy and
+// expiration on the returned wallets. Wallets of a tier whose grant failed are left out.
+func grantFeeByTier(s *sentinel.Sentinel, policies *feegrant.Policies, wallets []models.Wallet) ([]models.Wallet, error) {
+	tiers := make(map[string][]models.Wallet)
+	for _, wallet := range wallets {
+		tiers[wallet.Tier] = append(tiers[wallet.Tier], wallet)
+	}
+
+	var granted []models.Wallet
+	var grantErr error
+
+	for tier, tierWallets := range tiers {
+		policyName, policy := policies.ForTier(tier)
+		allowance := policy.Allowance(time.Now())
+
+		var walletAddresses []string
+		for _, wallet := range tierWallets {
+			walletAddresses = append(walletAddresses, wallet.Address)
+		}
+
+		err := s.GrantFeeToWallet(walletAddresses, allowance)
+		if err != nil {
+			grantErr = err
+			continue
+		}
+
+		for _, wallet := range tierWallets {
+			wallet.IsFeeGranted = true
+			wallet.FeeGrantPolicy = &policyName
+			wallet.FeeGrantExpiresAt = allowance.Expiration
+			granted = append(granted, wallet)
+		}
+	}
+
+	return granted, grantErr
+}
+
+// excludeDeregistered drops the wallets that were deregistered since they were loaded, right before
+// they would be granted.
+func excludeDeregistered(db *gorm.DB, wallets []models.Wallet) ([]models.Wallet, error) {
+	var ids []uint
+	for _, wallet := range wallets {
+		ids = append(ids, wallet.ID)
+	}
+
+	var activeIds []uint
+	err := db.Model(&models.Wallet{}).Where("id IN ? AND deregistered_at IS NULL", append(ids, 0)).Pluck("id", &activeIds).Error
+	if err != nil {
+		return nil, err
+	}
+
+	active := make(map[uint]bool)
+	for _, id := range activeIds {
+		active[id] = true
+	}
+
+	var result []models.Wallet
+	for _, wallet := range wallets {
+		if active[wallet.ID] {
+			result = append(result, wallet)
+		}
+	}
+
+	return result, nil
+}
+
+// saveGrantedWallet records the grant of a wallet unless it was deregistered in the meantime, in
+// which case the revocation of the wallet is queued again so the new allowance does not outlive it.
+func saveGrantedWallet(db *gorm.DB, wallet models.Wallet, updates map[string]interface{}) (bool, error) {
+	tx := db.Model(&models.Wallet{}).Where("id = ? AND deregistered_at IS NULL", wallet.ID).Updates(updates)
+	if tx.Error != nil {
+		return false, tx.Error
+	}
+
+	if tx.RowsAffected > 0 {
+		return true, nil
+	}
+
+	err := db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "wallet_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"status":       models.WalletRevocationStatusPending,
+			"attempts":     0,
+			"last_error":   nil,
+			"completed_at": nil,
+		}),
+	}).Create(&models.WalletRevocation{
+		WalletID: wallet.ID,
+		Address:  wallet.Address,
+		Source:   models.WalletRevocationSourceSystem,
+		Status:   models.WalletRevocationStatusPending,
+	}).Error
+
+	return false, err
+}
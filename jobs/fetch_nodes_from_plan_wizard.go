@@ -1,19 +1,40 @@
 package jobs
 
 import (
+	"context"
+	"dvpn/internal/aggregates"
+	"dvpn/internal/banpolicy"
 	"dvpn/internal/planwizard"
+	"dvpn/internal/protocols"
+	"dvpn/internal/snapshot"
+	"dvpn/internal/versionpolicy"
 	"dvpn/models"
 	"errors"
+	"fmt"
 	"go.uber.org/zap"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"net"
+	"net/url"
+	"sync"
 	"time"
 )
 
+const (
+	remoteHostResolveTimeout = 5 * time.Second
+	remoteHostResolveWorkers = 32
+)
+
 type FetchNodesFromPlanWizard struct {
 	DB         *gorm.DB
 	Logger     *zap.SugaredLogger
 	PlanWizard *planwizard.PlanWizard
+	Protocols  *protocols.Registry
+	BanPolicy  *banpolicy.Engine
+	Catalog    *snapshot.Exporter
+	Aggregates *aggregates.Cache
+
+	VersionPolicy *versionpolicy.Policy
 }
 
 func (job FetchNodesFromPlanWizard) Run() {
@@ -28,6 +49,7 @@ func (job FetchNodesFromPlanWizard) Run() {
 	job.Logger.Infof("fetched %d nodes from Plan Wizard API", len(*nodes))
 
 	revision := time.Now().Unix()
+	remoteIps := job.resolveRemoteIPs(*nodes)
 
 	for _, node := range *nodes {
 		protocol, err := job.parseNodeProtocol(&node)
@@ -38,6 +60,7 @@ func (job FetchNodesFromPlanWizard) Run() {
 
 		configuration := datatypes.NewJSONType(job.parseNodeConfiguration(&node))
 		currentLoad := job.parseCurrentLoad(&node)
+		isVersionSupported := job.parseVersionSupport(&node, *protocol)
 		countryId, err := job.parseCountryId(&node)
 		if err != nil {
 			job.Logger.Errorf("failed to determine country id for %s: %s", node.Address, err)
@@ -62,12 +85,14 @@ func (job FetchNodesFromPlanWizard) Run() {
 			server.CurrentLoad = currentLoad
 			server.IsActive = true
 			server.Revision = revision
+			server.IsVersionSupported = isVersionSupported
 
 			tx = job.DB.Save(&server)
 			if tx.Error != nil {
 				job.Logger.Errorf("failed to update server %s in the DB: %s", node.Address, tx.Error)
 			} else {
 				job.Logger.Infof("updated DB record for server %s", node.Address)
+				job.saveRemoteIPs(server, remoteIps)
 			}
 		} else {
 			if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
@@ -82,6 +107,8 @@ func (job FetchNodesFromPlanWizard) Run() {
 					Protocol:      *protocol,
 					Configuration: configuration,
 					Revision:      revision,
+
+					IsVersionSupported: isVersionSupported,
 				}
 
 				tx = job.DB.Create(&server)
@@ -89,6 +116,7 @@ func (job FetchNodesFromPlanWizard) Run() {
 					job.Logger.Errorf("failed to create server %s in the DB: %s", node.Address, tx.Error)
 				} else {
 					job.Logger.Infof("created DB record for server %s", node.Address)
+					job.saveRemoteIPs(server, remoteIps)
 				}
 			} else {
 				job.Logger.Errorf("failed to fetch server %s from database: %s", node.Address, tx.Error)
@@ -102,6 +130,27 @@ func (job FetchNodesFromPlanWizard) Run() {
 	} else {
 		job.Logger.Infof("deactivated %d inactive servers", tx.RowsAffected)
 	}
+
+	if job.BanPolicy != nil {
+		changes, err := job.BanPolicy.Apply()
+		if err != nil {
+			job.Logger.Errorf("failed to apply ban policy: %s", err)
+		} else {
+			job.Logger.Infof("applied ban policy with %d changes", len(changes))
+		}
+	}
+
+	job.trackCatalogChanges(revision)
+	job.refreshCatalogAggregates(revision)
+
+	if job.Catalog != nil {
+		manifest, err := job.Catalog.Export(revision)
+		if err != nil {
+			job.Logger.Errorf("failed to export catalog snapshot for revision %d: %s", revision, err)
+		} else {
+			job.Logger.Infof("exported catalog snapshot %s", manifest.Key)
+		}
+	}
 }
 
 func (job FetchNodesFromPlanWizard) fetchNodes() (*[]planwizard.Node, error) {
@@ -151,24 +200,41 @@ func (job FetchNodesFromPlanWizard) parseNodePrices(node *planwizard.Node) (int6
 }
 
 func (job FetchNodesFromPlanWizard) parseNodeProtocol(node *planwizard.Node) (*models.ServerProtocol, error) {
-	var protocol models.ServerProtocol
-
-	if *node.Type == 1 {
-		protocol = models.ServerProtocolWireGuard
-		return &protocol, nil
+	if node.Type == nil {
+		return nil, errors.New("missing node type")
 	}
 
-	if *node.Type == 2 {
-		protocol = models.ServerProtocolV2Ray
-		return &protocol, nil
+	protocol, ok := job.Protocols.ByTypeCode(*node.Type)
+	if !ok {
+		return nil, fmt.Errorf("unknown protocol for node type %d", *node.Type)
 	}
 
-	return nil, errors.New("unknown protocol")
+	return &protocol.Name, nil
 }
 
 func (job FetchNodesFromPlanWizard) parseNodeConfiguration(node *planwizard.Node) models.ServerConfiguration {
 	pricePerGB, pricePerHour := job.parseNodePrices(node)
 
+	var gigabytePrices []models.ServerPrice
+	for _, gigabytePrice := range node.GigabytePrices {
+		gigabytePrices = append(gigabytePrices, models.ServerPrice{Denom: gigabytePrice.Denom, Amount: gigabytePrice.Amount})
+	}
+
+	var hourlyPrices []models.ServerPrice
+	for _, hourlyPrice := range node.HourlyPrices {
+		hourlyPrices = append(hourlyPrices, models.ServerPrice{Denom: hourlyPrice.Denom, Amount: hourlyPrice.Amount})
+	}
+
+	var asn string
+	if node.ASN != nil {
+		asn = *node.ASN
+	}
+
+	var operator string
+	if node.Operator != nil {
+		operator = *node.Operator
+	}
+
 	return models.ServerConfiguration{
 		RemoteURL:         node.RemoteUrl,
 		BandwidthDownload: *node.BandwidthDownload,
@@ -180,6 +246,10 @@ func (job FetchNodesFromPlanWizard) parseNodeConfiguration(node *planwizard.Node
 		PricePerGB:        pricePerGB,
 		PricePerHour:      pricePerHour,
 		Version:           *node.Version,
+		ASN:               asn,
+		Operator:          operator,
+		GigabytePrices:    gigabytePrices,
+		HourlyPrices:      hourlyPrices,
 	}
 }
 
@@ -192,6 +262,159 @@ func (job FetchNodesFromPlanWizard) parseCurrentLoad(node *planwizard.Node) floa
 	return currentLoad
 }
 
+// resolveRemoteIPs resolves the remote URL hosts of the nodes concurrently into all of their A and
+// AAAA records, keyed by node address. Nodes whose host failed to resolve are left out, so their
+// previously resolved addresses are kept.
+func (job FetchNodesFromPlanWizard) resolveRemoteIPs(nodes []planwizard.Node) map[string][]string {
+	type resolution struct {
+		address string
+		ips     []string
+	}
+
+	queue := make(chan planwizard.Node)
+	results := make(chan resolution)
+
+	var wg sync.WaitGroup
+	for i := 0; i < remoteHostResolveWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for node := range queue {
+				ips, err := parseRemoteIPs(&node)
+				if err != nil {
+					job.Logger.Warnf("failed to resolve remote URL %s of %s: %s", node.RemoteUrl, node.Address, err)
+					continue
+				}
+
+				results <- resolution{address: node.Address, ips: ips}
+			}
+		}()
+	}
+
+	go func() {
+		for _, node := range nodes {
+			queue <- node
+		}
+
+		close(queue)
+		wg.Wait()
+		close(results)
+	}()
+
+	remoteIps := make(map[string][]string)
+	for result := range results {
+		remoteIps[result.address] = result.ips
+	}
+
+	return remoteIps
+}
+
+func parseRemoteIPs(node *planwizard.Node) ([]string, error) {
+	remoteUrl, err := url.Parse(node.RemoteUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	host := remoteUrl.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{ip.String()}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), remoteHostResolveTimeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(addrs) == 0 {
+		return nil, errors.New("no A or AAAA records")
+	}
+
+	var ips []string
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP.String())
+	}
+
+	return ips, nil
+}
+
+// saveRemoteIPs replaces the remote IPs of a server with the ones its host resolved to.
+func (job FetchNodesFromPlanWizard) saveRemoteIPs(server models.Server, remoteIps map[string][]string) {
+	ips, ok := remoteIps[server.Address]
+	if !ok {
+		return
+	}
+
+	err := job.DB.Transaction(func(tx *gorm.DB) error {
+		var existing []models.ServerRemoteIP
+		err := tx.Where("server_id = ?", server.ID).Find(&existing).Error
+		if err != nil {
+			return err
+		}
+
+		kept := make(map[string]bool)
+		var staleIds []uint
+		for _, remoteIp := range existing {
+			ip := net.ParseIP(remoteIp.IP)
+			if ip != nil && containsIP(ips, ip) && !kept[ip.String()] {
+				kept[ip.String()] = true
+			} else {
+				staleIds = append(staleIds, remoteIp.ID)
+			}
+		}
+
+		if len(staleIds) > 0 {
+			err = tx.Delete(&models.ServerRemoteIP{}, staleIds).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		var added []models.ServerRemoteIP
+		for _, ip := range ips {
+			if !kept[ip] {
+				kept[ip] = true
+				added = append(added, models.ServerRemoteIP{ServerID: server.ID, IP: ip})
+			}
+		}
+
+		if len(added) == 0 {
+			return nil
+		}
+
+		return tx.Create(&added).Error
+	})
+	if err != nil {
+		job.Logger.Errorf("failed to save remote IPs of server %s: %s", server.Address, err)
+	}
+}
+
+func containsIP(ips []string, ip net.IP) bool {
+	for _, candidate := range ips {
+		if ip.Equal(net.ParseIP(candidate)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (job FetchNodesFromPlanWizard) parseVersionSupport(node *planwizard.Node, protocol models.ServerProtocol) bool {
+	if job.VersionPolicy == nil {
+		return true
+	}
+
+	isSupported, reason := job.VersionPolicy.IsSupported(protocol, *node.Version)
+	if !isSupported {
+		job.Logger.Infof("server %s runs unsupported node version: %s", node.Address, reason)
+	}
+
+	return isSupported
+}
+
 func (job FetchNodesFromPlanWizard) parseCountryId(node *planwizard.Node) (uint, error) {
 	countryName := *node.LocationCountry
 
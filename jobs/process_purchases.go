@@ -1,11 +1,13 @@
 package jobs
 
 import (
+	"dvpn/internal/feegrant"
 	"dvpn/internal/sentinel"
 	"dvpn/models"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 	"strconv"
+	"time"
 )
 
 type ProcessPurchases struct {
@@ -17,7 +19,7 @@ type ProcessPurchases struct {
 func (job ProcessPurchases) Run() {
 	var purchases []models.Purchase
 
-	tx := job.DB.Model(&models.Purchase{}).Order("id desc").Limit(100).Where("is_redeemed = FALSE").Find(&purchases)
+	tx := job.DB.Model(&models.Purchase{}).Order("id desc").Limit(100).Where("is_redeemed = FALSE AND refunded_at IS NULL").Find(&purchases)
 	if tx.Error != nil {
 		job.Logger.Error("failed to get purchases from the DB: " + tx.Error.Error())
 		return
@@ -27,17 +29,22 @@ func (job ProcessPurchases) Run() {
 		return
 	}
 
-	chunks := job.formChunks(purchases, 10)
+	chunks := chunk(purchases, 10)
 	for _, chunk := range chunks {
 
 		var ids []uint
 		var walletAddresses []string
 		var amounts []string
+		var payingWalletAddresses []string
 
 		for _, purchase := range chunk {
 			ids = append(ids, purchase.ID)
 			walletAddresses = append(walletAddresses, purchase.Address)
 			amounts = append(amounts, strconv.Itoa(int(purchase.Amount))+purchase.Denom)
+
+			if purchase.Source == models.PurchaseSourcePurchase {
+				payingWalletAddresses = append(payingWalletAddresses, purchase.Address)
+			}
 		}
 
 		err := job.Sentinel.SendTokensToWallet(walletAddresses, amounts)
@@ -50,14 +57,11 @@ func (job ProcessPurchases) Run() {
 		if err != nil {
 			job.Logger.Error("failed to update purchases: " + err.Error())
 		}
-	}
-}
 
-func (job ProcessPurchases) formChunks(purchases []models.Purchase, chunkSize int) [][]models.Purchase {
-	var chunks [][]models.Purchase
-	for chunkSize < len(purchases) {
-		purchases, chunks = purchases[chunkSize:], append(chunks, purchases[0:chunkSize:chunkSize])
+		// Upgraded wallets are marked as expiring so RenewFeeGrants re-grants them with the paid tier policy.
+		err = job.DB.Model(&models.Wallet{}).Where("address IN ? AND tier <> ?", append(payingWalletAddresses, ""), feegrant.TierPaid).Updates(map[string]interface{}{"tier": feegrant.TierPaid, "fee_grant_expires_at": time.Now()}).Error
+		if err != nil {
+			job.Logger.Error("failed to upgrade wallet tiers: " + err.Error())
+		}
 	}
-	chunks = append(chunks, purchases)
-	return chunks
 }
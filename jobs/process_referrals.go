@@ -0,0 +1,128 @@
+package jobs
+
+import (
+	"dvpn/models"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// ProcessReferrals rewards both sides of a referral once a purchase of the referee is redeemed, was
+// made at least RefundWindow ago and is not refunded. Refunds reported after the rewards are queued
+// do not take them back.
+// Rewards are queued as purchases with the REFERRAL source and paid by ProcessPurchases.
+type ProcessReferrals struct {
+	DB     *gorm.DB
+	Logger *zap.SugaredLogger
+
+	ReferrerReward        int64
+	RefereeReward         int64
+	Denom                 string
+	MaxRewardsPerReferrer int64
+	RefundWindow          time.Duration
+}
+
+func (job ProcessReferrals) Run() {
+	var referrals []models.Referral
+
+	tx := job.DB.Preload("Referrer").Preload("Referee").
+		Where("status = ? AND EXISTS (SELECT 1 FROM purchases AS p INNER JOIN wallets AS w ON w.address = p.address WHERE w.id = referrals.referee_id AND p.source = ? AND p.is_redeemed = TRUE AND p.refunded_at IS NULL AND p.created_at <= ?)", models.ReferralStatusPending, models.PurchaseSourcePurchase, time.Now().Add(-job.RefundWindow)).
+		Order("id").
+		Limit(100).
+		Find(&referrals)
+	if tx.Error != nil {
+		job.Logger.Error("failed to get pending referrals from the DB: " + tx.Error.Error())
+		return
+	}
+
+	for _, referral := range referrals {
+		rejectionReason, err := job.check(referral)
+		if err != nil {
+			job.Logger.Errorf("failed to check referral %d: %s", referral.ID, err)
+			continue
+		}
+
+		if rejectionReason != "" {
+			tx = job.DB.Model(&models.Referral{}).Where("id = ?", referral.ID).Updates(map[string]interface{}{
+				"status":           models.ReferralStatusRejected,
+				"rejection_reason": rejectionReason,
+			})
+			if tx.Error != nil {
+				job.Logger.Errorf("failed to reject referral %d: %s", referral.ID, tx.Error)
+			}
+			continue
+		}
+
+		err = job.reward(referral)
+		if err != nil {
+			job.Logger.Errorf("failed to reward referral %d: %s", referral.ID, err)
+			continue
+		}
+
+		job.Logger.Infof("rewarded referral of wallet %s by wallet %s", referral.Referee.Address, referral.Referrer.Address)
+	}
+}
+
+func (job ProcessReferrals) check(referral models.Referral) (string, error) {
+	if referral.Referrer.DeregisteredAt != nil || referral.Referee.DeregisteredAt != nil {
+		return models.ReferralRejectionDeregistered, nil
+	}
+
+	if referral.Referrer.RegistrationSubnet != nil && referral.Referee.RegistrationSubnet != nil && *referral.Referrer.RegistrationSubnet == *referral.Referee.RegistrationSubnet {
+		return models.ReferralRejectionSameSubnet, nil
+	}
+
+	if job.MaxRewardsPerReferrer > 0 {
+		var rewarded int64
+		tx := job.DB.Model(&models.Referral{}).Where("referrer_id = ? AND status = ?", referral.ReferrerID, models.ReferralStatusRewarded).Count(&rewarded)
+		if tx.Error != nil {
+			return "", tx.Error
+		}
+
+		if rewarded >= job.MaxRewardsPerReferrer {
+			return models.ReferralRejectionReferrerCap, nil
+		}
+	}
+
+	return "", nil
+}
+
+func (job ProcessReferrals) reward(referral models.Referral) error {
+	var rewards []models.Purchase
+
+	if job.ReferrerReward > 0 {
+		rewards = append(rewards, models.Purchase{
+			EventId: fmt.Sprintf("referral-%d-referrer", referral.ID),
+			Address: referral.Referrer.Address,
+			Amount:  job.ReferrerReward,
+			Denom:   job.Denom,
+			Source:  models.PurchaseSourceReferral,
+		})
+	}
+
+	if job.RefereeReward > 0 {
+		rewards = append(rewards, models.Purchase{
+			EventId: fmt.Sprintf("referral-%d-referee", referral.ID),
+			Address: referral.Referee.Address,
+			Amount:  job.RefereeReward,
+			Denom:   job.Denom,
+			Source:  models.PurchaseSourceReferral,
+		})
+	}
+
+	return job.DB.Transaction(func(tx *gorm.DB) error {
+		if len(rewards) > 0 {
+			err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rewards).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&models.Referral{}).Where("id = ?", referral.ID).Updates(map[string]interface{}{
+			"status":      models.ReferralStatusRewarded,
+			"rewarded_at": time.Now(),
+		}).Error
+	})
+}
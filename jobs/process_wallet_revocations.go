@@ -0,0 +1,144 @@
+package jobs
+
+import (
+	"dvpn/internal/sentinel"
+	"dvpn/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+const maxWalletRevocationAttempts = 5
+
+type ProcessWalletRevocations struct {
+	DB       *gorm.DB
+	Logger   *zap.SugaredLogger
+	Sentinel *sentinel.Sentinel
+}
+
+func (job ProcessWalletRevocations) Run() {
+	var revocations []models.WalletRevocation
+
+	tx := job.DB.Model(&models.WalletRevocation{}).Order("id").Limit(500).Where("status = ?", models.WalletRevocationStatusPending).Find(&revocations)
+	if tx.Error != nil {
+		job.Logger.Error("failed to get wallet revocations from the DB: " + tx.Error.Error())
+		return
+	}
+
+	chunks := chunk(revocations, 100)
+	for _, chunk := range chunks {
+		if len(chunk) == 0 {
+			continue
+		}
+
+		var walletsForRevokingFee []string
+		var processed []models.WalletRevocation
+
+		for _, revocation := range chunk {
+			existingAllowances, err := fetchAllowances(job.Sentinel, revocation.Address)
+			if err != nil {
+				job.failRevocations([]models.WalletRevocation{revocation}, "failed to fetch existing grant fee allowances: "+err.Error())
+				continue
+			}
+
+			if findAllowance(existingAllowances, revocation.Address, job.Sentinel.FeeGranterWalletAddress) != nil {
+				walletsForRevokingFee = append(walletsForRevokingFee, revocation.Address)
+			}
+
+			processed = append(processed, revocation)
+		}
+
+		if len(walletsForRevokingFee) > 0 {
+			err := job.Sentinel.RevokeFeeFromWallets(walletsForRevokingFee)
+			if err != nil {
+				job.Logger.Error("failed to revoke fee grants from deregistered wallets: " + err.Error())
+				processed = job.revokeEach(processed, walletsForRevokingFee, err)
+			}
+		}
+
+		var ids []uint
+		var walletIds []uint
+		for _, revocation := range processed {
+			ids = append(ids, revocation.ID)
+			walletIds = append(walletIds, revocation.WalletID)
+		}
+
+		if len(ids) == 0 {
+			continue
+		}
+
+		err := job.DB.Transaction(func(tx *gorm.DB) error {
+			err := tx.Model(&models.Wallet{}).Where("id IN ?", walletIds).Updates(map[string]interface{}{
+				"is_fee_granted":       false,
+				"fee_grant_expires_at": nil,
+				"fee_grant_revoked_at": time.Now(),
+			}).Error
+			if err != nil {
+				return err
+			}
+
+			return tx.Model(&models.WalletRevocation{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+				"status":       models.WalletRevocationStatusCompleted,
+				"completed_at": time.Now(),
+				"attempts":     gorm.Expr("attempts + 1"),
+				"last_error":   nil,
+			}).Error
+		})
+		if err != nil {
+			job.Logger.Error("failed to update completed wallet revocations: " + err.Error())
+			continue
+		}
+
+		job.Logger.Infof("revoked fee grants from %d deregistered wallets", len(walletsForRevokingFee))
+	}
+}
+
+// revokeEach retries a failed batch revocation one wallet at a time, so a single wallet that cannot
+// be revoked does not fail the whole chunk. It records a failed attempt for the revocations of wallets
+// that still fail and returns the remaining revocations, including those without a fee grant.
+func (job ProcessWalletRevocations) revokeEach(revocations []models.WalletRevocation, walletAddresses []string, batchErr error) []models.WalletRevocation {
+	failed := map[string]string{}
+	if len(walletAddresses) == 1 {
+		failed[walletAddresses[0]] = batchErr.Error()
+	} else {
+		for _, walletAddress := range walletAddresses {
+			err := job.Sentinel.RevokeFeeFromWallets([]string{walletAddress})
+			if err != nil {
+				job.Logger.Errorf("failed to revoke fee grant from deregistered wallet %s: %s", walletAddress, err)
+				failed[walletAddress] = err.Error()
+			}
+		}
+	}
+
+	var revoked []models.WalletRevocation
+	for _, revocation := range revocations {
+		reason, ok := failed[revocation.Address]
+		if ok {
+			job.failRevocations([]models.WalletRevocation{revocation}, reason)
+			continue
+		}
+
+		revoked = append(revoked, revocation)
+	}
+
+	return revoked
+}
+
+// failRevocations records a failed attempt, giving up after maxWalletRevocationAttempts.
+func (job ProcessWalletRevocations) failRevocations(revocations []models.WalletRevocation, reason string) {
+	for _, revocation := range revocations {
+		status := models.WalletRevocationStatusPending
+		if revocation.Attempts+1 >= maxWalletRevocationAttempts {
+			status = models.WalletRevocationStatusFailed
+		}
+
+		err := job.DB.Model(&models.WalletRevocation{}).Where("id = ?", revocation.ID).Updates(map[string]interface{}{
+			"status":     status,
+			"attempts":   revocation.Attempts + 1,
+			"last_error": reason,
+		}).Error
+		if err != nil {
+			job.Logger.Error("failed to update wallet revocation: " + err.Error())
+		}
+	}
+}
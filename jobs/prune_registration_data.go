@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"dvpn/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+const registrationRejectionsRetention = 30 * 24 * time.Hour
+
+type PruneRegistrationData struct {
+	DB     *gorm.DB
+	Logger *zap.SugaredLogger
+}
+
+func (job PruneRegistrationData) Run() {
+	tx := job.DB.Where("expires_at < ?", time.Now()).Delete(&models.RegistrationChallenge{})
+	if tx.Error != nil {
+		job.Logger.Error("failed to delete expired registration challenges: " + tx.Error.Error())
+	}
+
+	tx = job.DB.Where("expires_at < ?", time.Now()).Delete(&models.UsedWalletSignature{})
+	if tx.Error != nil {
+		job.Logger.Error("failed to delete expired wallet signatures: " + tx.Error.Error())
+	}
+
+	tx = job.DB.Where("created_at < ?", time.Now().Add(-registrationRejectionsRetention)).Delete(&models.RegistrationRejection{})
+	if tx.Error != nil {
+		job.Logger.Error("failed to delete old registration rejections: " + tx.Error.Error())
+	}
+}
@@ -0,0 +1,19 @@
+package jobs
+
+import (
+	"dvpn/internal/aggregates"
+)
+
+func (job FetchNodesFromPlanWizard) refreshCatalogAggregates(revision int64) {
+	err := aggregates.Rebuild(job.DB, revision)
+	if err != nil {
+		job.Logger.Errorf("failed to refresh catalog aggregates for revision %d: %s", revision, err)
+		return
+	}
+
+	if job.Aggregates != nil {
+		job.Aggregates.Invalidate()
+	}
+
+	job.Logger.Infof("refreshed catalog aggregates for revision %d", revision)
+}
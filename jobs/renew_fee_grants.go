@@ -0,0 +1,113 @@
+package jobs
+
+import (
+	"dvpn/internal/feegrant"
+	"dvpn/internal/sentinel"
+	"dvpn/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+type RenewFeeGrants struct {
+	DB       *gorm.DB
+	Logger   *zap.SugaredLogger
+	Sentinel *sentinel.Sentinel
+	Policies *feegrant.Policies
+
+	RenewalWindow    time.Duration
+	InactivityPeriod time.Duration
+}
+
+func (job RenewFeeGrants) Run() {
+	var wallets []models.Wallet
+
+	now := time.Now()
+	tx := job.DB.Model(&models.Wallet{}).
+		Where("is_fee_granted = TRUE AND deregistered_at IS NULL AND fee_grant_expires_at < ? AND last_seen_at > ?", now.Add(job.RenewalWindow), now.Add(-job.InactivityPeriod)).
+		Order("fee_grant_expires_at").
+		Limit(1000).
+		Find(&wallets)
+	if tx.Error != nil {
+		job.Logger.Error("failed to get expiring wallets from the DB: " + tx.Error.Error())
+		return
+	}
+
+	chunks := chunk(wallets, 100)
+	for _, chunk := range chunks {
+		if len(chunk) == 0 {
+			continue
+		}
+
+		var walletsForRevokingFee []string
+		var walletsForGrantingFee []models.Wallet
+
+		for _, wallet := range chunk {
+			existingAllowances, err := fetchAllowances(job.Sentinel, wallet.Address)
+			if err != nil {
+				job.Logger.Errorf("failed to fetch existing grant fee allowances from Sentinel for wallet %s: "+err.Error(), wallet.Address)
+				continue
+			}
+
+			if findAllowance(existingAllowances, wallet.Address, job.Sentinel.FeeGranterWalletAddress) != nil {
+				walletsForRevokingFee = append(walletsForRevokingFee, wallet.Address)
+			}
+
+			walletsForGrantingFee = append(walletsForGrantingFee, wallet)
+		}
+
+		if len(walletsForRevokingFee) > 0 {
+			err := job.Sentinel.RevokeFeeFromWallets(walletsForRevokingFee)
+			if err != nil {
+				job.Logger.Error("failed to revoke expiring fee grants: " + err.Error())
+				continue
+			}
+		}
+
+		walletsForGrantingFee, err := excludeDeregistered(job.DB, walletsForGrantingFee)
+		if err != nil {
+			job.Logger.Error("failed to check wallets for deregistration: " + err.Error())
+			continue
+		}
+
+		granted, err := grantFeeByTier(job.Sentinel, job.Policies, walletsForGrantingFee)
+		if err != nil {
+			job.Logger.Error("failed to renew fee grants: " + err.Error())
+		}
+
+		grantedAddresses := make(map[string]bool)
+		for _, wallet := range granted {
+			grantedAddresses[wallet.Address] = true
+
+			isSaved, err := saveGrantedWallet(job.DB, wallet, map[string]interface{}{
+				"fee_grant_policy":     wallet.FeeGrantPolicy,
+				"fee_grant_expires_at": wallet.FeeGrantExpiresAt,
+			})
+			if err != nil {
+				job.Logger.Error("failed to update renewed wallet: " + err.Error())
+				continue
+			}
+
+			if !isSaved {
+				job.Logger.Warnf("wallet %s was deregistered while its fee grant was renewed, queued its revocation again", wallet.Address)
+			}
+		}
+
+		// Wallets that could not be granted again are handed back to EnrollWallets so they are not left without a grant.
+		var failedAddresses []string
+		for _, wallet := range walletsForGrantingFee {
+			if !grantedAddresses[wallet.Address] {
+				failedAddresses = append(failedAddresses, wallet.Address)
+			}
+		}
+
+		if len(failedAddresses) > 0 {
+			err = job.DB.Model(&models.Wallet{}).Where("address IN ?", failedAddresses).Updates(map[string]interface{}{"is_fee_granted": false, "fee_grant_expires_at": nil}).Error
+			if err != nil {
+				job.Logger.Error("failed to reset wallets after failed renewal: " + err.Error())
+			}
+		}
+
+		job.Logger.Infof("renewed fee grants for %d wallets", len(granted))
+	}
+}
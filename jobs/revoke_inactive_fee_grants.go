@@ -0,0 +1,78 @@
+package jobs
+
+import (
+	"dvpn/internal/sentinel"
+	"dvpn/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+type RevokeInactiveFeeGrants struct {
+	DB       *gorm.DB
+	Logger   *zap.SugaredLogger
+	Sentinel *sentinel.Sentinel
+
+	InactivityPeriod time.Duration
+}
+
+func (job RevokeInactiveFeeGrants) Run() {
+	var wallets []models.Wallet
+
+	inactiveSince := time.Now().Add(-job.InactivityPeriod)
+	tx := job.DB.Model(&models.Wallet{}).
+		Where("is_fee_granted = TRUE AND deregistered_at IS NULL AND COALESCE(last_seen_at, created_at) < ?", inactiveSince).
+		Order("id").
+		Limit(1000).
+		Find(&wallets)
+	if tx.Error != nil {
+		job.Logger.Error("failed to get inactive wallets from the DB: " + tx.Error.Error())
+		return
+	}
+
+	chunks := chunk(wallets, 100)
+	for _, chunk := range chunks {
+		if len(chunk) == 0 {
+			continue
+		}
+
+		var walletsForRevokingFee []string
+		var revokedWallets []string
+
+		for _, wallet := range chunk {
+			existingAllowances, err := fetchAllowances(job.Sentinel, wallet.Address)
+			if err != nil {
+				job.Logger.Errorf("failed to fetch existing grant fee allowances from Sentinel for wallet %s: "+err.Error(), wallet.Address)
+				continue
+			}
+
+			if findAllowance(existingAllowances, wallet.Address, job.Sentinel.FeeGranterWalletAddress) != nil {
+				walletsForRevokingFee = append(walletsForRevokingFee, wallet.Address)
+			}
+
+			revokedWallets = append(revokedWallets, wallet.Address)
+		}
+
+		if len(walletsForRevokingFee) > 0 {
+			err := job.Sentinel.RevokeFeeFromWallets(walletsForRevokingFee)
+			if err != nil {
+				job.Logger.Error("failed to revoke fee grants from inactive wallets: " + err.Error())
+				continue
+			}
+		}
+
+		if len(revokedWallets) > 0 {
+			err := job.DB.Model(&models.Wallet{}).Where("address IN ?", revokedWallets).Updates(map[string]interface{}{
+				"is_fee_granted":       false,
+				"fee_grant_expires_at": nil,
+				"fee_grant_revoked_at": time.Now(),
+			}).Error
+			if err != nil {
+				job.Logger.Error("failed to update revoked wallets: " + err.Error())
+				continue
+			}
+		}
+
+		job.Logger.Infof("revoked fee grants from %d inactive wallets", len(revokedWallets))
+	}
+}
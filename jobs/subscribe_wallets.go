@@ -0,0 +1,215 @@
+package jobs
+
+import (
+	"dvpn/internal/sentinel"
+	"dvpn/models"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+const maxPlanAllocationAttempts = 5
+
+// SubscribeWallets allocates bytes of the fee granter's subscription to the provider plan to every
+// enrolled wallet, so apps do not have to subscribe on their own. The subscription is taken from
+// SubscriptionID when configured and is created on first use otherwise. Allocations of deregistered
+// wallets are released.
+type SubscribeWallets struct {
+	DB       *gorm.DB
+	Logger   *zap.SugaredLogger
+	Sentinel *sentinel.Sentinel
+
+	SubscriptionID int64
+	AllocatedBytes string
+}
+
+func (job SubscribeWallets) Run() {
+	job.allocate()
+	job.release()
+}
+
+func (job SubscribeWallets) allocate() {
+	var wallets []models.Wallet
+
+	tx := job.retryableWallets().
+		Where("is_fee_granted = TRUE AND deregistered_at IS NULL AND plan_subscription_status = ?", models.PlanSubscriptionStatusPending).
+		Find(&wallets)
+	if tx.Error != nil {
+		job.Logger.Error("failed to get unsubscribed wallets from the DB: " + tx.Error.Error())
+		return
+	}
+
+	if len(wallets) == 0 {
+		return
+	}
+
+	subscriptionId, err := job.subscription()
+	if err != nil {
+		job.Logger.Error("failed to get plan subscription: " + err.Error())
+		return
+	}
+
+	chunks := chunk(wallets, 100)
+	for _, chunk := range chunks {
+		var ids []uint
+		var walletAddresses []string
+
+		for _, wallet := range chunk {
+			ids = append(ids, wallet.ID)
+			walletAddresses = append(walletAddresses, wallet.Address)
+		}
+
+		err = job.Sentinel.AllocateSubscription(subscriptionId, walletAddresses, job.AllocatedBytes)
+		if err != nil {
+			job.Logger.Error("failed to allocate plan subscription to wallets: " + err.Error())
+			job.failWallets(chunk, models.PlanSubscriptionStatusPending, err.Error())
+			continue
+		}
+
+		err = job.DB.Model(&models.Wallet{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"plan_subscription_id":     subscriptionId,
+			"plan_subscription_status": models.PlanSubscriptionStatusAllocated,
+			"plan_allocated_at":        time.Now(),
+			"plan_allocation_attempts": 0,
+			"plan_allocation_error":    nil,
+		}).Error
+		if err != nil {
+			job.Logger.Error("failed to update subscribed wallets: " + err.Error())
+			continue
+		}
+
+		job.Logger.Infof("allocated plan subscription %d to %d wallets", subscriptionId, len(ids))
+	}
+}
+
+// release takes back the bytes allocated to deregistered wallets.
+func (job SubscribeWallets) release() {
+	var wallets []models.Wallet
+
+	tx := job.retryableWallets().
+		Where("plan_subscription_status = ? AND plan_subscription_id IS NOT NULL", models.PlanSubscriptionStatusReleasing).
+		Find(&wallets)
+	if tx.Error != nil {
+		job.Logger.Error("failed to get deregistered subscribed wallets from the DB: " + tx.Error.Error())
+		return
+	}
+
+	bySubscription := make(map[int64][]models.Wallet)
+	for _, wallet := range wallets {
+		bySubscription[*wallet.PlanSubscriptionID] = append(bySubscription[*wallet.PlanSubscriptionID], wallet)
+	}
+
+	for subscriptionId, subscriptionWallets := range bySubscription {
+		chunks := chunk(subscriptionWallets, 100)
+		for _, chunk := range chunks {
+			var ids []uint
+			var walletAddresses []string
+
+			for _, wallet := range chunk {
+				ids = append(ids, wallet.ID)
+				walletAddresses = append(walletAddresses, wallet.Address)
+			}
+
+			err := job.Sentinel.AllocateSubscription(subscriptionId, walletAddresses, "0")
+			if err != nil {
+				job.Logger.Error("failed to release plan subscription allocations: " + err.Error())
+				job.failWallets(chunk, models.PlanSubscriptionStatusReleasing, err.Error())
+				continue
+			}
+
+			err = job.DB.Model(&models.Wallet{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+				"plan_subscription_status": models.PlanSubscriptionStatusReleased,
+				"plan_allocation_attempts": 0,
+				"plan_allocation_error":    nil,
+			}).Error
+			if err != nil {
+				job.Logger.Error("failed to update released wallets: " + err.Error())
+				continue
+			}
+
+			job.Logger.Infof("released plan subscription %d allocations of %d wallets", subscriptionId, len(ids))
+		}
+	}
+}
+
+// retryableWallets selects wallets whose last allocation attempt is older than the backoff, which
+// grows by a minute with each failed attempt.
+func (job SubscribeWallets) retryableWallets() *gorm.DB {
+	return job.DB.Model(&models.Wallet{}).
+		Where("(plan_allocation_attempted_at IS NULL OR plan_allocation_attempted_at + plan_allocation_attempts * INTERVAL '1 minute' < ?)", time.Now()).
+		Order("id").
+		Limit(1000)
+}
+
+// failWallets records a failed attempt, giving up after maxPlanAllocationAttempts.
+func (job SubscribeWallets) failWallets(wallets []models.Wallet, retryStatus string, reason string) {
+	for _, wallet := range wallets {
+		status := retryStatus
+		if wallet.PlanAllocationAttempts+1 >= maxPlanAllocationAttempts {
+			status = models.PlanSubscriptionStatusFailed
+		}
+
+		err := job.DB.Model(&models.Wallet{}).Where("id = ?", wallet.ID).Updates(map[string]interface{}{
+			"plan_subscription_status":     status,
+			"plan_allocation_attempts":     wallet.PlanAllocationAttempts + 1,
+			"plan_allocation_attempted_at": time.Now(),
+			"plan_allocation_error":        reason,
+		}).Error
+		if err != nil {
+			job.Logger.Error("failed to update wallet plan allocation: " + err.Error())
+		}
+	}
+}
+
+func (job SubscribeWallets) subscription() (int64, error) {
+	if job.SubscriptionID != 0 {
+		return job.SubscriptionID, nil
+	}
+
+	var subscription models.PlanSubscription
+	tx := job.DB.Where("plan_id = ? AND owner = ?", job.Sentinel.ProviderPlanBlockchainID, job.Sentinel.FeeGranterWalletAddress).First(&subscription)
+	if tx.Error == nil {
+		if subscription.SubscriptionID == 0 {
+			return 0, fmt.Errorf("subscription to plan %s requested at %s has no recorded ID, set SENTINEL_PLAN_SUBSCRIPTION_ID to the fee granter's subscription", subscription.PlanID, subscription.CreatedAt.Format(time.RFC3339))
+		}
+
+		return subscription.SubscriptionID, nil
+	}
+
+	if !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return 0, tx.Error
+	}
+
+	// The pending row is saved first: if the subscription ID cannot be recorded after subscribing,
+	// the next run finds it instead of subscribing again.
+	subscription = models.PlanSubscription{
+		PlanID: job.Sentinel.ProviderPlanBlockchainID,
+		Owner:  job.Sentinel.FeeGranterWalletAddress,
+	}
+
+	tx = job.DB.Create(&subscription)
+	if tx.Error != nil {
+		return 0, errors.New("failed to save pending plan subscription: " + tx.Error.Error())
+	}
+
+	subscriptionId, err := job.Sentinel.SubscribeToPlan(job.Sentinel.DefaultDenom)
+	if err != nil {
+		tx = job.DB.Delete(&subscription)
+		if tx.Error != nil {
+			job.Logger.Errorf("failed to delete pending plan subscription %d: %s", subscription.ID, tx.Error)
+		}
+
+		return 0, err
+	}
+
+	tx = job.DB.Model(&subscription).Update("subscription_id", subscriptionId)
+	if tx.Error != nil {
+		return 0, fmt.Errorf("failed to save plan subscription %d: %s", subscriptionId, tx.Error)
+	}
+
+	job.Logger.Infof("subscribed to plan %s with subscription %d", subscription.PlanID, subscriptionId)
+
+	return subscriptionId, nil
+}
@@ -0,0 +1,170 @@
+package jobs
+
+import (
+	"crypto/sha256"
+	"dvpn/models"
+	"encoding/hex"
+	"encoding/json"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math"
+	"math/bits"
+	"time"
+)
+
+const catalogRevisionsRetention = 7 * 24 * time.Hour
+
+func (job FetchNodesFromPlanWizard) trackCatalogChanges(revision int64) {
+	var servers []models.Server
+	tx := job.DB.Model(&models.Server{}).Where("is_active = ? AND is_banned = ? AND is_version_supported = ?", true, false, true).Find(&servers)
+	if tx.Error != nil {
+		job.Logger.Errorf("failed to get servers for catalog revision %d: %s", revision, tx.Error)
+		return
+	}
+
+	var entries []models.CatalogEntry
+	tx = job.DB.Model(&models.CatalogEntry{}).Find(&entries)
+	if tx.Error != nil {
+		job.Logger.Errorf("failed to get catalog entries for revision %d: %s", revision, tx.Error)
+		return
+	}
+
+	existing := make(map[uint]models.CatalogEntry)
+	for _, entry := range entries {
+		existing[entry.ServerID] = entry
+	}
+
+	catalogRevision := models.CatalogRevision{Revision: revision}
+	visible := make(map[uint]bool)
+
+	var updated []models.CatalogEntry
+
+	for _, server := range servers {
+		visible[server.ID] = true
+
+		hash, err := hashServer(server)
+		if err != nil {
+			job.Logger.Errorf("failed to hash server %s: %s", server.Address, err)
+			continue
+		}
+
+		entry, ok := existing[server.ID]
+		if !ok || entry.RemovedRevision != nil {
+			entry.ServerID = server.ID
+			entry.AddedRevision = revision
+			entry.ChangedRevision = revision
+			entry.RemovedRevision = nil
+			catalogRevision.Added++
+		} else if entry.Hash != hash {
+			entry.ChangedRevision = revision
+			catalogRevision.Changed++
+		} else {
+			continue
+		}
+
+		entry.ID = 0
+		entry.Address = server.Address
+		entry.Hash = hash
+		updated = append(updated, entry)
+	}
+
+	for _, entry := range entries {
+		if entry.RemovedRevision == nil && !visible[entry.ServerID] {
+			removedRevision := revision
+			entry.ID = 0
+			entry.RemovedRevision = &removedRevision
+			updated = append(updated, entry)
+			catalogRevision.Removed++
+		}
+	}
+
+	err := job.DB.Transaction(func(tx *gorm.DB) error {
+		if len(updated) > 0 {
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "server_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"address", "hash", "added_revision", "changed_revision", "removed_revision", "updated_at"}),
+			}).CreateInBatches(&updated, 500).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&catalogRevision).Error
+	})
+	if err != nil {
+		job.Logger.Errorf("failed to save catalog revision %d: %s", revision, err)
+		return
+	}
+
+	job.Logger.Infof("catalog revision %d: %d added, %d changed, %d removed", revision, catalogRevision.Added, catalogRevision.Changed, catalogRevision.Removed)
+
+	oldestRevision := time.Now().Add(-catalogRevisionsRetention).Unix()
+
+	tx = job.DB.Where("revision < ?", oldestRevision).Delete(&models.CatalogRevision{})
+	if tx.Error != nil {
+		job.Logger.Errorf("failed to delete old catalog revisions: %s", tx.Error)
+	}
+
+	tx = job.DB.Where("removed_revision < ?", oldestRevision).Delete(&models.CatalogEntry{})
+	if tx.Error != nil {
+		job.Logger.Errorf("failed to delete removed catalog entries: %s", tx.Error)
+	}
+}
+
+// hashServer hashes the fields of a server that matter to the catalog. The load and bandwidth change
+// on nearly every fetch, so only coarse buckets of them are hashed: a server is marked as changed when
+// its load crosses a 10% step or its bandwidth halves or doubles, and delta clients get the current
+// values along with it.
+func hashServer(server models.Server) (string, error) {
+	type catalogFields struct {
+		Address            string
+		Name               string
+		CountryID          uint
+		CityID             uint
+		Latitude           float64
+		Longitude          float64
+		Protocol           models.ServerProtocol
+		RemoteURL          string
+		Version            string
+		IsActive           bool
+		IsBanned           bool
+		IsVersionSupported bool
+		PricePerGB         int64
+		PricePerHour       int64
+		GigabytePrices     []models.ServerPrice
+		HourlyPrices       []models.ServerPrice
+		LoadBucket         int
+		DownloadBucket     int
+		UploadBucket       int
+	}
+
+	configuration := server.Configuration.Data()
+
+	data, err := json.Marshal(catalogFields{
+		Address:            server.Address,
+		Name:               server.Name,
+		CountryID:          server.CountryID,
+		CityID:             server.CityID,
+		Latitude:           configuration.LocationLat,
+		Longitude:          configuration.LocationLon,
+		Protocol:           server.Protocol,
+		RemoteURL:          configuration.RemoteURL,
+		Version:            configuration.Version,
+		IsActive:           server.IsActive,
+		IsBanned:           server.IsBanned,
+		IsVersionSupported: server.IsVersionSupported,
+		PricePerGB:         configuration.PricePerGB,
+		PricePerHour:       configuration.PricePerHour,
+		GigabytePrices:     configuration.GigabytePrices,
+		HourlyPrices:       configuration.HourlyPrices,
+		LoadBucket:         int(math.Floor(server.CurrentLoad * 10)),
+		DownloadBucket:     bits.Len64(uint64(configuration.BandwidthDownload)),
+		UploadBucket:       bits.Len64(uint64(configuration.BandwidthUpload)),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
@@ -0,0 +1,86 @@
+package jobs
+
+import (
+	"crypto/sha256"
+	"dvpn/models"
+	"encoding/hex"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type TrialPolicy struct {
+	Amount      int64
+	Denom       string
+	DailyBudget int64
+}
+
+// trialHash is the hash of a registration IP address or subnet stored in trial grants. The same
+// hashes are computed in SQL by core.HashTrialGrantAddresses.
+func trialHash(kind string, value string) string {
+	hash := sha256.Sum256([]byte("trial-" + kind + ":" + value))
+	return hex.EncodeToString(hash[:])
+}
+
+// queueTrialGrants queues a one-time trial payout for newly granted wallets, at most one per wallet,
+// per registration IP address and per registration subnet. Trials pause for the rest of the UTC day
+// once the daily budget is spent.
+func queueTrialGrants(db *gorm.DB, logger *zap.SugaredLogger, policy *TrialPolicy, wallets []models.Wallet) {
+	if policy == nil || policy.Amount <= 0 {
+		return
+	}
+
+	for _, wallet := range wallets {
+		if wallet.RegistrationIP == nil || wallet.RegistrationSubnet == nil {
+			continue
+		}
+
+		var spent int64
+		tx := db.Model(&models.Purchase{}).Select("COALESCE(SUM(amount), 0)").Where("source = ? AND created_at >= ?", models.PurchaseSourceTrial, time.Now().UTC().Truncate(24*time.Hour)).Scan(&spent)
+		if tx.Error != nil {
+			logger.Error("failed to get spent trial budget: " + tx.Error.Error())
+			return
+		}
+
+		if spent+policy.Amount > policy.DailyBudget {
+			logger.Warnf("trial budget of %d%s exhausted for today, trials are paused", policy.DailyBudget, policy.Denom)
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			ipHash := trialHash("ip", *wallet.RegistrationIP)
+			subnetHash := trialHash("subnet", *wallet.RegistrationSubnet)
+			grant := models.TrialGrant{
+				WalletID:   wallet.ID,
+				IPHash:     &ipHash,
+				SubnetHash: &subnetHash,
+			}
+
+			// A conflict on the wallet, IP address or subnet means a trial was already granted.
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&grant)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+
+			purchase := models.Purchase{
+				EventId: fmt.Sprintf("trial-%d", wallet.ID),
+				Address: wallet.Address,
+				Amount:  policy.Amount,
+				Denom:   policy.Denom,
+				Source:  models.PurchaseSourceTrial,
+			}
+
+			err := tx.Create(&purchase).Error
+			if err != nil {
+				return err
+			}
+
+			return tx.Model(&grant).Update("purchase_id", purchase.ID).Error
+		})
+		if err != nil {
+			logger.Errorf("failed to queue trial grant for wallet %s: %s", wallet.Address, err)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+)
+
+func RequireAuthorization(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		auth := c.GetHeader("Authorization")
+		if token == "" || subtle.ConstantTimeCompare([]byte(auth), []byte(token)) != 1 {
+			RespondErr(c, APIErrorUnauthorized, "invalid authorization header")
+			return
+		}
+
+		c.Next()
+	}
+}
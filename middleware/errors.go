@@ -8,4 +8,6 @@ var (
 	APIErrorUnknown        APIError = errors.New("unknownError")
 	APIErrorInvalidRequest APIError = errors.New("invalidRequest")
 	APIErrorNotFound       APIError = errors.New("notFound")
+	APIErrorUnauthorized   APIError = errors.New("unauthorized")
+	APIErrorRateLimited    APIError = errors.New("rateLimited")
 )
@@ -33,6 +33,10 @@ func RespondErr(c *gin.Context, error APIError, reason string) {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, r)
 	} else if error == APIErrorNotFound {
 		c.AbortWithStatusJSON(http.StatusNotFound, r)
+	} else if error == APIErrorUnauthorized {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, r)
+	} else if error == APIErrorRateLimited {
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, r)
 	} else {
 		c.AbortWithStatusJSON(http.StatusBadRequest, r)
 	}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"dvpn/internal/walletauth"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const WalletAddressKey = "wallet_address"
+
+const (
+	walletSignatureMaxAge  = 5 * time.Minute
+	walletRequestMaxLength = 1 << 20
+)
+
+type SignatureRegistry interface {
+	Claim(signature []byte, expiresAt time.Time) (bool, error)
+}
+
+// RequireWalletSignature authenticates requests to /wallet/:address routes. The wallet signs
+// "<METHOD> <path>[?<query>] <unix timestamp> <hex SHA-256 of the body>" with ADR-036 and sends
+// the public key, signature and timestamp in X-Wallet-Public-Key, X-Wallet-Signature and
+// X-Wallet-Timestamp. Each signature is accepted once.
+func RequireWalletSignature(hrp string, signatures SignatureRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		address := strings.ToLower(c.Params.ByName("address"))
+
+		timestamp, err := strconv.ParseInt(c.GetHeader("X-Wallet-Timestamp"), 10, 64)
+		if err != nil {
+			RespondErr(c, APIErrorUnauthorized, "invalid wallet signature timestamp")
+			return
+		}
+
+		age := time.Since(time.Unix(timestamp, 0))
+		if age > walletSignatureMaxAge || age < -walletSignatureMaxAge {
+			RespondErr(c, APIErrorUnauthorized, "expired wallet signature")
+			return
+		}
+
+		publicKey, err := base64.StdEncoding.DecodeString(c.GetHeader("X-Wallet-Public-Key"))
+		if err != nil {
+			RespondErr(c, APIErrorUnauthorized, "invalid wallet public key: "+err.Error())
+			return
+		}
+
+		signature, err := base64.StdEncoding.DecodeString(c.GetHeader("X-Wallet-Signature"))
+		if err != nil {
+			RespondErr(c, APIErrorUnauthorized, "invalid wallet signature: "+err.Error())
+			return
+		}
+
+		signer, err := walletauth.AddressFromPublicKey(hrp, publicKey)
+		if err != nil {
+			RespondErr(c, APIErrorUnauthorized, "invalid wallet public key: "+err.Error())
+			return
+		}
+
+		if signer != address {
+			RespondErr(c, APIErrorUnauthorized, "public key does not match wallet address")
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			body, err = io.ReadAll(io.LimitReader(c.Request.Body, walletRequestMaxLength+1))
+			if err != nil {
+				RespondErr(c, APIErrorInvalidRequest, "failed to read request body: "+err.Error())
+				return
+			}
+
+			if len(body) > walletRequestMaxLength {
+				RespondErr(c, APIErrorInvalidRequest, "request body too large")
+				return
+			}
+
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		err = walletauth.VerifyADR036(publicKey, signature, signer, []byte(walletSignedData(c, timestamp, body)))
+		if err != nil {
+			RespondErr(c, APIErrorUnauthorized, err.Error())
+			return
+		}
+
+		isFirstUse, err := signatures.Claim(signature, time.Unix(timestamp, 0).Add(walletSignatureMaxAge))
+		if err != nil {
+			RespondErr(c, APIErrorUnknown, "failed to record wallet signature: "+err.Error())
+			return
+		}
+
+		if !isFirstUse {
+			RespondErr(c, APIErrorUnauthorized, "wallet signature already used")
+			return
+		}
+
+		c.Set(WalletAddressKey, signer)
+		c.Next()
+	}
+}
+
+func walletSignedData(c *gin.Context, timestamp int64, body []byte) string {
+	target := c.Request.URL.Path
+	if c.Request.URL.RawQuery != "" {
+		target += "?" + c.Request.URL.RawQuery
+	}
+
+	bodyHash := sha256.Sum256(body)
+
+	return fmt.Sprintf("%s %s %d %s", c.Request.Method, target, timestamp, hex.EncodeToString(bodyHash[:]))
+}
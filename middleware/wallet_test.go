@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"dvpn/internal/walletauth"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/gin-gonic/gin"
+)
+
+type memorySignatureRegistry map[string]bool
+
+func (r memorySignatureRegistry) Claim(signature []byte, expiresAt time.Time) (bool, error) {
+	key := string(signature)
+	if r[key] {
+		return false, nil
+	}
+
+	r[key] = true
+	return true, nil
+}
+
+type signedRequest struct {
+	method    string
+	target    string
+	body      string
+	timestamp int64
+}
+
+func signADR036(t *testing.T, key *secp256k1.PrivateKey, signer string, data string) []byte {
+	type msgValue struct {
+		Data   string `json:"data"`
+		Signer string `json:"signer"`
+	}
+
+	signDoc, err := json.Marshal(map[string]any{
+		"account_number": "0",
+		"chain_id":       "",
+		"fee":            map[string]any{"amount": []any{}, "gas": "0"},
+		"memo":           "",
+		"msgs": []any{map[string]any{
+			"type":  "sign/MsgSignData",
+			"value": msgValue{Data: base64.StdEncoding.EncodeToString([]byte(data)), Signer: signer},
+		}},
+		"sequence": "0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := sha256.Sum256(signDoc)
+	return ecdsa.SignCompact(key, hash[:], true)[1:]
+}
+
+// malleate returns the other valid encoding (r, n-s) of a 64-byte r||s signature.
+func malleate(signature []byte) []byte {
+	var s secp256k1.ModNScalar
+	s.SetByteSlice(signature[32:])
+	s.Negate()
+
+	encoded := s.Bytes()
+	return append(append([]byte{}, signature[:32]...), encoded[:]...)
+}
+
+func TestRequireWalletSignature(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	key := secp256k1.PrivKeyFromBytes([]byte{0x12, 0x34, 0x56, 0x78, 0x90, 0xab, 0xcd, 0xef})
+	publicKey := key.PubKey().SerializeCompressed()
+	address, err := walletauth.AddressFromPublicKey("sent", publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := memorySignatureRegistry{}
+
+	engine := gin.New()
+	engine.PUT("/wallet/:address/preferences", RequireWalletSignature("sent", registry), func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	})
+
+	now := time.Now().Unix()
+	path := "/wallet/" + address + "/preferences"
+
+	sign := func(signed signedRequest) []byte {
+		bodyHash := sha256.Sum256([]byte(signed.body))
+		data := signed.method + " " + signed.target + " " + strconv.FormatInt(signed.timestamp, 10) + " " + hex.EncodeToString(bodyHash[:])
+
+		return signADR036(t, key, address, data)
+	}
+
+	sendSignature := func(signature []byte, actual signedRequest) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(actual.method, actual.target, strings.NewReader(actual.body))
+		request.Header.Set("X-Wallet-Public-Key", base64.StdEncoding.EncodeToString(publicKey))
+		request.Header.Set("X-Wallet-Signature", base64.StdEncoding.EncodeToString(signature))
+		request.Header.Set("X-Wallet-Timestamp", strconv.FormatInt(actual.timestamp, 10))
+
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	send := func(signed signedRequest, actual signedRequest) *httptest.ResponseRecorder {
+		return sendSignature(sign(signed), actual)
+	}
+
+	tests := []struct {
+		name   string
+		signed signedRequest
+		actual signedRequest
+		status int
+	}{
+		{
+			"valid",
+			signedRequest{"PUT", path + "?lang=en", `{"a":1}`, now},
+			signedRequest{"PUT", path + "?lang=en", `{"a":1}`, now},
+			http.StatusOK,
+		},
+		{
+			"different body",
+			signedRequest{"PUT", path, `{"a":1}`, now},
+			signedRequest{"PUT", path, `{"a":2}`, now},
+			http.StatusUnauthorized,
+		},
+		{
+			"different query",
+			signedRequest{"PUT", path + "?erase=false", ``, now},
+			signedRequest{"PUT", path + "?erase=true", ``, now},
+			http.StatusUnauthorized,
+		},
+		{
+			"different timestamp",
+			signedRequest{"PUT", path, ``, now},
+			signedRequest{"PUT", path, ``, now - 1},
+			http.StatusUnauthorized,
+		},
+		{
+			"expired",
+			signedRequest{"PUT", path, ``, now - 600},
+			signedRequest{"PUT", path, ``, now - 600},
+			http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		recorder := send(test.signed, test.actual)
+		if recorder.Code != test.status {
+			t.Errorf("%s: status %d, want %d: %s", test.name, recorder.Code, test.status, recorder.Body.String())
+		}
+
+		if test.status == http.StatusOK && recorder.Body.String() != test.actual.body {
+			t.Errorf("%s: handler received body %q, want %q", test.name, recorder.Body.String(), test.actual.body)
+		}
+	}
+
+	replayed := signedRequest{"PUT", path, `{"b":1}`, now}
+	if recorder := send(replayed, replayed); recorder.Code != http.StatusOK {
+		t.Fatalf("first use: status %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	if recorder := send(replayed, replayed); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("replay: status %d, want %d", recorder.Code, http.StatusUnauthorized)
+	}
+
+	malleated := signedRequest{"PUT", path, `{"c":1}`, now}
+	signature := sign(malleated)
+	if recorder := sendSignature(signature, malleated); recorder.Code != http.StatusOK {
+		t.Fatalf("original signature: status %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	if recorder := sendSignature(malleate(signature), malleated); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("malleated replay: status %d, want %d", recorder.Code, http.StatusUnauthorized)
+	}
+
+	fresh := signedRequest{"PUT", path, `{"d":1}`, now}
+	if recorder := sendSignature(malleate(sign(fresh)), fresh); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("high-S signature: status %d, want %d", recorder.Code, http.StatusUnauthorized)
+	}
+}
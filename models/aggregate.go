@@ -0,0 +1,78 @@
+package models
+
+type AggregateStats struct {
+	Servers         int64   `gorm:"not null" json:"servers"`
+	AverageLoad     float64 `gorm:"not null" json:"average_load"`
+	BestDownload    int64   `gorm:"not null" json:"best_download"`
+	BestUpload      int64   `gorm:"not null" json:"best_upload"`
+	MinPricePerGB   *int64  `json:"min_price_per_gb"`
+	MaxPricePerGB   *int64  `json:"max_price_per_gb"`
+	MinPricePerHour *int64  `json:"min_price_per_hour"`
+	MaxPricePerHour *int64  `json:"max_price_per_hour"`
+}
+
+type CountryAggregate struct {
+	Generic
+
+	CountryID uint           `gorm:"not null; uniqueIndex:idx_country_aggregate" json:"country_id"`
+	Protocol  ServerProtocol `gorm:"not null; uniqueIndex:idx_country_aggregate" json:"protocol"`
+	Revision  int64          `gorm:"not null" json:"revision"`
+
+	AggregateStats `gorm:"embedded"`
+}
+
+type CityAggregate struct {
+	Generic
+
+	CityID    uint           `gorm:"not null; uniqueIndex:idx_city_aggregate" json:"city_id"`
+	CountryID uint           `gorm:"index; not null" json:"country_id"`
+	Protocol  ServerProtocol `gorm:"not null; uniqueIndex:idx_city_aggregate" json:"protocol"`
+	Revision  int64          `gorm:"not null" json:"revision"`
+
+	AggregateStats `gorm:"embedded"`
+}
+
+func MergeAggregateStats(stats []AggregateStats) AggregateStats {
+	var merged AggregateStats
+	var totalLoad float64
+
+	for _, s := range stats {
+		merged.Servers += s.Servers
+		totalLoad += s.AverageLoad * float64(s.Servers)
+
+		if s.BestDownload > merged.BestDownload {
+			merged.BestDownload = s.BestDownload
+		}
+
+		if s.BestUpload > merged.BestUpload {
+			merged.BestUpload = s.BestUpload
+		}
+
+		merged.MinPricePerGB = minPrice(merged.MinPricePerGB, s.MinPricePerGB)
+		merged.MaxPricePerGB = maxPrice(merged.MaxPricePerGB, s.MaxPricePerGB)
+		merged.MinPricePerHour = minPrice(merged.MinPricePerHour, s.MinPricePerHour)
+		merged.MaxPricePerHour = maxPrice(merged.MaxPricePerHour, s.MaxPricePerHour)
+	}
+
+	if merged.Servers > 0 {
+		merged.AverageLoad = totalLoad / float64(merged.Servers)
+	}
+
+	return merged
+}
+
+func minPrice(a *int64, b *int64) *int64 {
+	if a == nil || (b != nil && *b < *a) {
+		return b
+	}
+
+	return a
+}
+
+func maxPrice(a *int64, b *int64) *int64 {
+	if a == nil || (b != nil && *b > *a) {
+		return b
+	}
+
+	return a
+}
@@ -0,0 +1,22 @@
+package models
+
+type CatalogRevision struct {
+	Generic
+
+	Revision int64 `gorm:"not null; unique" json:"revision"`
+	Added    int64 `gorm:"not null" json:"added"`
+	Changed  int64 `gorm:"not null" json:"changed"`
+	Removed  int64 `gorm:"not null" json:"removed"`
+}
+
+type CatalogEntry struct {
+	Generic
+
+	ServerID uint   `gorm:"not null; unique" json:"server_id"`
+	Address  string `gorm:"not null" json:"address"`
+	Hash     string `gorm:"not null" json:"-"`
+
+	AddedRevision   int64  `gorm:"index; not null" json:"added_revision"`
+	ChangedRevision int64  `gorm:"index; not null" json:"changed_revision"`
+	RemovedRevision *int64 `gorm:"index" json:"removed_revision"`
+}
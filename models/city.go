@@ -6,6 +6,7 @@ type City struct {
 	CountryID uint    `gorm:"index;not null" json:"country_id"`
 	Country   Country `json:"-"`
 
-	Name             string `gorm:"not null" json:"name"`
-	ServersAvailable int    `gorm:"<-:false;->;-:migration" json:"servers_available"`
+	Name             string          `gorm:"not null" json:"name"`
+	ServersAvailable int             `gorm:"<-:false;->;-:migration" json:"servers_available"`
+	Stats            *AggregateStats `gorm:"-" json:"stats,omitempty"`
 }
@@ -6,5 +6,6 @@ type Country struct {
 	Name string `gorm:"not null; unique" json:"name"`
 	Code string `gorm:"not null; unique" json:"code"`
 
-	ServersAvailable int `gorm:"<-:false;->;-:migration" json:"servers_available"`
+	ServersAvailable int             `gorm:"<-:false;->;-:migration" json:"servers_available"`
+	Stats            *AggregateStats `gorm:"-" json:"stats,omitempty"`
 }
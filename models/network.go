@@ -1,7 +1,11 @@
 package models
 
 type Network struct {
-	Network   string `gorm:"type:cidr; unique"`
-	Latitude  float64
-	Longitude float64
+	Network        string `gorm:"type:cidr; unique"`
+	Latitude       float64
+	Longitude      float64
+	CountryCode    *string
+	City           *string
+	ASN            *int64
+	ASOrganization *string
 }
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+type Product struct {
+	Generic
+
+	StoreProductId string     `gorm:"not null; unique" json:"store_product_id"`
+	Name           string     `gorm:"not null" json:"name"`
+	Amount         int64      `gorm:"not null" json:"amount"`
+	Denom          string     `gorm:"not null" json:"denom"`
+	IsSubscription bool       `gorm:"not null; default:false" json:"is_subscription"`
+	ActiveFrom     *time.Time `json:"active_from"`
+	ActiveUntil    *time.Time `json:"active_until"`
+
+	Overrides []ProductOverride `gorm:"constraint:OnDelete:CASCADE" json:"overrides"`
+}
+
+// ProductOverride replaces the store product ID, amount or denom of a product in a single store.
+type ProductOverride struct {
+	Generic
+
+	ProductID      uint    `gorm:"not null; uniqueIndex:idx_product_override" json:"-"`
+	Store          string  `gorm:"not null; uniqueIndex:idx_product_override; uniqueIndex:idx_product_override_store_product" json:"store"`
+	StoreProductId *string `gorm:"uniqueIndex:idx_product_override_store_product" json:"store_product_id"`
+	Amount         *int64  `json:"amount"`
+	Denom          *string `json:"denom"`
+}
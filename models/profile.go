@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+type WalletFavorite struct {
+	Generic
+
+	WalletID uint   `gorm:"not null; uniqueIndex:idx_wallet_favorite" json:"-"`
+	Wallet   Wallet `json:"-"`
+
+	ServerAddress string `gorm:"not null; uniqueIndex:idx_wallet_favorite" json:"server_address"`
+}
+
+type WalletRecent struct {
+	Generic
+
+	WalletID uint   `gorm:"not null; uniqueIndex:idx_wallet_recent" json:"-"`
+	Wallet   Wallet `json:"-"`
+
+	ServerAddress string    `gorm:"not null; uniqueIndex:idx_wallet_recent" json:"server_address"`
+	ConnectedAt   time.Time `gorm:"index; not null" json:"connected_at"`
+}
+
+type WalletPreferences struct {
+	Generic
+
+	WalletID uint   `gorm:"not null; unique" json:"-"`
+	Wallet   Wallet `json:"-"`
+
+	PreferredProtocol *ServerProtocol `json:"preferred_protocol"`
+	DefaultCountryID  *uint           `json:"default_country_id"`
+	DefaultCountry    *Country        `json:"-"`
+}
@@ -1,5 +1,14 @@
 package models
 
+import "time"
+
+const (
+	PurchaseSourcePurchase = "PURCHASE"
+	PurchaseSourceReferral = "REFERRAL"
+	PurchaseSourceVoucher  = "VOUCHER"
+	PurchaseSourceTrial    = "TRIAL"
+)
+
 type Purchase struct {
 	Generic
 
@@ -8,6 +17,23 @@ type Purchase struct {
 	Address string `gorm:"not null" json:"address"`
 	Amount  int64  `gorm:"not null" json:"amount"`
 	Denom   string `gorm:"not null" json:"denom"`
+	Source  string `gorm:"index; not null; default:'PURCHASE'" json:"source"`
+
+	// Store details are only set for purchases made through RevenueCat.
+	EventType             *string  `json:"event_type"`
+	Store                 *string  `json:"store"`
+	Environment           *string  `json:"environment"`
+	ProductId             *string  `json:"product_id"`
+	TransactionId         *string  `gorm:"index" json:"transaction_id"`
+	OriginalTransactionId *string  `gorm:"index" json:"original_transaction_id"`
+	Price                 *float64 `json:"price"`
+	Currency              *string  `json:"currency"`
+
+	StoreSubscriptionID *uint `gorm:"index" json:"store_subscription_id"`
+
+	CancelledAt        *time.Time `json:"cancelled_at"`
+	CancellationReason *string    `json:"cancellation_reason"`
+	RefundedAt         *time.Time `json:"refunded_at"`
 
 	IsRedeemed bool `gorm:"not null; default:false" json:"is_redeemed"`
 }
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+const (
+	ReferralStatusPending  = "PENDING"
+	ReferralStatusRewarded = "REWARDED"
+	ReferralStatusRejected = "REJECTED"
+)
+
+const (
+	ReferralRejectionSameSubnet   = "SAME_SUBNET"
+	ReferralRejectionReferrerCap  = "REFERRER_CAP"
+	ReferralRejectionDeregistered = "DEREGISTERED"
+)
+
+type Referral struct {
+	Generic
+
+	ReferrerID uint   `gorm:"index; not null" json:"-"`
+	Referrer   Wallet `json:"-"`
+	RefereeID  uint   `gorm:"not null; unique" json:"-"`
+	Referee    Wallet `json:"-"`
+
+	Status          string     `gorm:"index; not null" json:"status"`
+	RejectionReason *string    `json:"rejection_reason"`
+	RewardedAt      *time.Time `json:"rewarded_at"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+const (
+	RegistrationRejectionBlockedSubnet  = "BLOCKED_SUBNET"
+	RegistrationRejectionIPLimit        = "IP_LIMIT"
+	RegistrationRejectionSubnetLimit    = "SUBNET_LIMIT"
+	RegistrationRejectionProofOfWork    = "PROOF_OF_WORK"
+	RegistrationRejectionChallengeReuse = "CHALLENGE_REUSE"
+)
+
+type RegistrationRejection struct {
+	Generic
+
+	Address  string  `gorm:"index; not null" json:"address"`
+	ClientIP *string `gorm:"type:inet" json:"client_ip"`
+	Subnet   *string `gorm:"type:cidr; index" json:"subnet"`
+	Reason   string  `gorm:"index; not null" json:"reason"`
+	Details  string  `gorm:"not null; default:''" json:"details"`
+}
+
+type RegistrationChallenge struct {
+	Generic
+
+	Challenge string    `gorm:"not null; unique" json:"challenge"`
+	ExpiresAt time.Time `gorm:"index; not null" json:"expires_at"`
+}
+
+type BlockedSubnet struct {
+	Generic
+
+	Subnet string `gorm:"type:cidr; not null; unique" json:"subnet"`
+	Reason string `gorm:"not null; default:''" json:"reason"`
+}
@@ -0,0 +1,28 @@
+package models
+
+type ConnectionReport struct {
+	Generic
+
+	ServerID uint   `gorm:"index; not null" json:"server_id"`
+	Server   Server `json:"-"`
+
+	IsSuccessful      bool           `gorm:"not null" json:"is_successful"`
+	HandshakeMs       *int64         `json:"handshake_ms"`
+	ThroughputKbps    *int64         `json:"throughput_kbps"`
+	Protocol          ServerProtocol `gorm:"not null" json:"protocol"`
+	ClientCountryCode *string        `json:"client_country_code"`
+	ClientNetwork     *string        `gorm:"type:cidr; index" json:"-"`
+	ClientSubnet      *string        `gorm:"type:cidr; index" json:"-"`
+}
+
+type ServerReliability struct {
+	Generic
+
+	ServerID uint `gorm:"not null; unique" json:"-"`
+
+	Reports           int64    `gorm:"not null" json:"reports"`
+	SuccessRate       float64  `gorm:"not null" json:"success_rate"`
+	Score             float64  `gorm:"index; not null" json:"score"`
+	AvgHandshakeMs    *float64 `json:"avg_handshake_ms"`
+	AvgThroughputKbps *float64 `json:"avg_throughput_kbps"`
+}
@@ -0,0 +1,27 @@
+package models
+
+const (
+	RevenueCatOutcomeQueued    = "QUEUED"
+	RevenueCatOutcomeRecorded  = "RECORDED"
+	RevenueCatOutcomeUnmatched = "UNMATCHED"
+	RevenueCatOutcomeIgnored   = "IGNORED"
+)
+
+// RevenueCatEvent is kept for every webhook delivery, so retried deliveries are acknowledged once
+// and events that did not result in a payout can still be audited.
+type RevenueCatEvent struct {
+	Generic
+
+	EventId     string `gorm:"not null; unique" json:"event_id"`
+	Type        string `gorm:"index; not null" json:"type"`
+	Environment string `gorm:"not null" json:"environment"`
+	Store       string `gorm:"not null" json:"store"`
+	AppUserId   string `gorm:"not null" json:"app_user_id"`
+	ProductId   string `gorm:"not null" json:"product_id"`
+
+	TransactionId         string `json:"transaction_id"`
+	OriginalTransactionId string `json:"original_transaction_id"`
+
+	Outcome    string `gorm:"not null" json:"outcome"`
+	PurchaseID *uint  `json:"purchase_id"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+const (
+	WalletRevocationStatusPending   = "PENDING"
+	WalletRevocationStatusCompleted = "COMPLETED"
+	WalletRevocationStatusFailed    = "FAILED"
+)
+
+const (
+	WalletRevocationSourceUser   = "USER"
+	WalletRevocationSourceAdmin  = "ADMIN"
+	WalletRevocationSourceSystem = "SYSTEM"
+)
+
+type WalletRevocation struct {
+	Generic
+
+	WalletID uint   `gorm:"not null; unique" json:"-"`
+	Wallet   Wallet `json:"-"`
+
+	Address  string `gorm:"not null" json:"address"`
+	Source   string `gorm:"not null" json:"source"`
+	Reason   string `gorm:"not null; default:''" json:"reason"`
+	IsErased bool   `gorm:"not null; default:false" json:"is_erased"`
+
+	Status      string     `gorm:"index; not null" json:"status"`
+	Attempts    int        `gorm:"not null; default:0" json:"attempts"`
+	LastError   *string    `json:"last_error"`
+	CompletedAt *time.Time `json:"completed_at"`
+}
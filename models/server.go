@@ -3,14 +3,15 @@ package models
 import (
 	"encoding/json"
 	"gorm.io/datatypes"
+	"time"
 )
 
 type ServerProtocol string
 
-const (
-	ServerProtocolWireGuard ServerProtocol = "WIREGUARD"
-	ServerProtocolV2Ray     ServerProtocol = "V2RAY"
-)
+type ServerPrice struct {
+	Denom  string `json:"denom"`
+	Amount int64  `json:"amount"`
+}
 
 type ServerConfiguration struct {
 	RemoteURL         string  `json:"remoteURL"`
@@ -23,6 +24,11 @@ type ServerConfiguration struct {
 	PricePerGB        int64   `json:"pricePerGB"`
 	PricePerHour      int64   `json:"pricePerHour"`
 	Version           string  `json:"version"`
+	ASN               string  `json:"asn"`
+	Operator          string  `json:"operator"`
+
+	GigabytePrices []ServerPrice `json:"gigabytePrices"`
+	HourlyPrices   []ServerPrice `json:"hourlyPrices"`
 }
 
 type Server struct {
@@ -34,48 +40,78 @@ type Server struct {
 	CityID uint `gorm:"index;not null" json:"city_id"`
 	City   City `json:"-"`
 
-	Name          string                                  `gorm:"not null"`
-	Address       string                                  `gorm:"index; not null"`
-	IsBanned      bool                                    `gorm:"index; not null; default:false"`
-	IsActive      bool                                    `gorm:"index; not null; default:false"`
-	CurrentLoad   float64                                 `gorm:"not null"`
-	Protocol      ServerProtocol                          `gorm:"index; not null"`
-	Configuration datatypes.JSONType[ServerConfiguration] `gorm:"type:json;not null"`
-	Revision      int64                                   `gorm:"index; not null"`
+	Name               string                                  `gorm:"not null"`
+	Address            string                                  `gorm:"index; not null"`
+	IsBanned           bool                                    `gorm:"index; not null; default:false"`
+	BanReason          *string                                 `gorm:"type:text"`
+	BanSource          string                                  `gorm:"index; not null; default:''"`
+	BanExpiresAt       *time.Time                              `gorm:"index"`
+	IsActive           bool                                    `gorm:"index; not null; default:false"`
+	IsVersionSupported bool                                    `gorm:"index; not null; default:true"`
+	CurrentLoad        float64                                 `gorm:"not null"`
+	Protocol           ServerProtocol                          `gorm:"index; not null"`
+	Configuration      datatypes.JSONType[ServerConfiguration] `gorm:"type:json;not null"`
+	Revision           int64                                   `gorm:"index; not null"`
+
+	OverloadedSince *time.Time
+
+	Reliability *ServerReliability `gorm:"foreignKey:ServerID"`
+}
+
+// ServerRemoteIP is one of the A or AAAA records the remote URL host of a server resolved to.
+type ServerRemoteIP struct {
+	Generic
+
+	ServerID uint   `gorm:"not null; uniqueIndex:idx_server_remote_ip"`
+	IP       string `gorm:"type:inet; not null; uniqueIndex:idx_server_remote_ip; index"`
 }
 
 func (s Server) MarshalJSON() ([]byte, error) {
 	type serverJSON struct {
-		ID            uint    `json:"id"`
-		CountryID     uint    `json:"country_id"`
-		CityID        uint    `json:"city_id"`
-		Name          string  `json:"name"`
-		Address       string  `json:"address"`
-		IsAvailable   bool    `json:"is_available"`
-		Load          float64 `json:"load"`
-		Version       string  `json:"version"`
-		Latitude      float64 `json:"latitude"`
-		Longitude     float64 `json:"longitude"`
-		UploadSpeed   int64   `json:"upload_speed"`
-		DownloadSpeed int64   `json:"download_speed"`
-		RemoteUrl     string  `json:"remote_url"`
-		Protocol      string  `json:"protocol"`
+		ID                 uint    `json:"id"`
+		CountryID          uint    `json:"country_id"`
+		CountryName        string  `json:"country_name,omitempty"`
+		CityID             uint    `json:"city_id"`
+		CityName           string  `json:"city_name,omitempty"`
+		Name               string  `json:"name"`
+		Address            string  `json:"address"`
+		IsAvailable        bool    `json:"is_available"`
+		Load               float64 `json:"load"`
+		Version            string  `json:"version"`
+		IsVersionSupported bool    `json:"is_version_supported"`
+		Latitude           float64 `json:"latitude"`
+		Longitude          float64 `json:"longitude"`
+		UploadSpeed        int64   `json:"upload_speed"`
+		DownloadSpeed      int64   `json:"download_speed"`
+		RemoteUrl          string  `json:"remote_url"`
+		Protocol           string  `json:"protocol"`
+		PricePerGB         int64   `json:"price_per_gb"`
+		PricePerHour       int64   `json:"price_per_hour"`
+
+		Reliability *ServerReliability `json:"reliability"`
 	}
 
 	server := serverJSON{
-		ID:          s.ID,
-		CountryID:   s.CountryID,
-		CityID:      s.CityID,
-		Name:        s.Name,
-		Address:     s.Address,
-		IsAvailable: s.IsActive,
-		Load:        s.CurrentLoad,
-		Version:     s.Configuration.Data().Version,
-		Latitude:    s.Configuration.Data().LocationLat,
-		Longitude:   s.Configuration.Data().LocationLon,
-		UploadSpeed: s.Configuration.Data().BandwidthUpload,
-		RemoteUrl:   s.Configuration.Data().RemoteURL,
-		Protocol:    string(s.Protocol),
+		ID:                 s.ID,
+		CountryID:          s.CountryID,
+		CountryName:        s.Country.Name,
+		CityID:             s.CityID,
+		CityName:           s.City.Name,
+		Name:               s.Name,
+		Address:            s.Address,
+		IsAvailable:        s.IsActive,
+		Load:               s.CurrentLoad,
+		Version:            s.Configuration.Data().Version,
+		IsVersionSupported: s.IsVersionSupported,
+		Latitude:           s.Configuration.Data().LocationLat,
+		Longitude:          s.Configuration.Data().LocationLon,
+		UploadSpeed:        s.Configuration.Data().BandwidthUpload,
+		DownloadSpeed:      s.Configuration.Data().BandwidthDownload,
+		RemoteUrl:          s.Configuration.Data().RemoteURL,
+		Protocol:           string(s.Protocol),
+		PricePerGB:         s.Configuration.Data().PricePerGB,
+		PricePerHour:       s.Configuration.Data().PricePerHour,
+		Reliability:        s.Reliability,
 	}
 
 	return json.Marshal(server)
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+const (
+	StoreSubscriptionStatusActive       = "ACTIVE"
+	StoreSubscriptionStatusBillingIssue = "BILLING_ISSUE"
+	StoreSubscriptionStatusExpired      = "EXPIRED"
+)
+
+// StoreSubscription is an auto-renewing product bought by a wallet through RevenueCat. It is
+// identified by the original transaction ID, which stays the same across renewals.
+type StoreSubscription struct {
+	Generic
+
+	Address               string `gorm:"index; not null" json:"address"`
+	Store                 string `gorm:"not null" json:"store"`
+	ProductId             string `gorm:"not null" json:"product_id"`
+	OriginalTransactionId string `gorm:"not null; unique" json:"original_transaction_id"`
+
+	Status     string `gorm:"index; not null; default:'ACTIVE'" json:"status"`
+	PeriodType string `gorm:"not null" json:"period_type"`
+	Renewals   int64  `gorm:"not null; default:0" json:"renewals"`
+
+	CurrentPeriodStartedAt *time.Time `json:"current_period_started_at"`
+	CurrentPeriodEndsAt    *time.Time `json:"current_period_ends_at"`
+	GracePeriodEndsAt      *time.Time `json:"grace_period_ends_at"`
+	AutoRenewCancelledAt   *time.Time `json:"auto_renew_cancelled_at"`
+	ExpiredAt              *time.Time `json:"expired_at"`
+	ExpirationReason       *string    `json:"expiration_reason"`
+}
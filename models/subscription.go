@@ -0,0 +1,21 @@
+package models
+
+const (
+	PlanSubscriptionStatusPending     = "PENDING"
+	PlanSubscriptionStatusAllocated   = "ALLOCATED"
+	PlanSubscriptionStatusFailed      = "FAILED"
+	PlanSubscriptionStatusReleasing   = "RELEASING"
+	PlanSubscriptionStatusReleased    = "RELEASED"
+	PlanSubscriptionStatusNotEligible = "NOT_ELIGIBLE"
+)
+
+// PlanSubscription records the fee granter's subscription to a plan. It is saved with a zero
+// SubscriptionID before subscribing, so a subscription whose ID could not be recorded is not
+// created a second time.
+type PlanSubscription struct {
+	Generic
+
+	PlanID         string `gorm:"not null; uniqueIndex:idx_plan_subscription" json:"plan_id"`
+	Owner          string `gorm:"not null; uniqueIndex:idx_plan_subscription" json:"owner"`
+	SubscriptionID int64  `gorm:"not null" json:"subscription_id"`
+}
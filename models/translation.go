@@ -0,0 +1,21 @@
+package models
+
+type CountryTranslation struct {
+	Generic
+
+	CountryID uint    `gorm:"not null; uniqueIndex:idx_country_translation" json:"country_id"`
+	Country   Country `json:"-"`
+
+	Language string `gorm:"not null; uniqueIndex:idx_country_translation" json:"language"`
+	Name     string `gorm:"not null" json:"name"`
+}
+
+type CityTranslation struct {
+	Generic
+
+	CityID uint `gorm:"not null; uniqueIndex:idx_city_translation" json:"city_id"`
+	City   City `json:"-"`
+
+	Language string `gorm:"not null; uniqueIndex:idx_city_translation" json:"language"`
+	Name     string `gorm:"not null" json:"name"`
+}
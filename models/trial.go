@@ -0,0 +1,16 @@
+package models
+
+// TrialGrant allows one trial per wallet, per registration IP address and per registration subnet.
+// The IP address and subnet are only kept as SHA-256 hashes, which survive the erasure of a wallet
+// so that it cannot be used to claim another trial from the same network.
+type TrialGrant struct {
+	Generic
+
+	WalletID   uint    `gorm:"not null; unique" json:"-"`
+	Wallet     Wallet  `json:"-"`
+	IPHash     *string `gorm:"type:char(64); unique" json:"-"`
+	SubnetHash *string `gorm:"type:char(64); unique" json:"-"`
+
+	PurchaseID *uint     `json:"-"`
+	Purchase   *Purchase `json:"-"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+type VoucherBatch struct {
+	Generic
+
+	Name           string     `gorm:"not null" json:"name"`
+	Amount         int64      `gorm:"not null" json:"amount"`
+	Denom          string     `gorm:"not null" json:"denom"`
+	MaxRedemptions int64      `gorm:"not null" json:"max_redemptions"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	Codes          int64      `gorm:"not null" json:"codes"`
+}
+
+type Voucher struct {
+	Generic
+
+	BatchID uint         `gorm:"index; not null" json:"batch_id"`
+	Batch   VoucherBatch `json:"-"`
+
+	Code        string `gorm:"not null; unique" json:"code"`
+	Redemptions int64  `gorm:"not null; default:0" json:"redemptions"`
+}
+
+type VoucherRedemption struct {
+	Generic
+
+	BatchID   uint `gorm:"not null; uniqueIndex:idx_voucher_redemption" json:"batch_id"`
+	WalletID  uint `gorm:"not null; uniqueIndex:idx_voucher_redemption" json:"-"`
+	VoucherID uint `gorm:"index; not null" json:"voucher_id"`
+
+	PurchaseID uint     `gorm:"not null" json:"-"`
+	Purchase   Purchase `json:"-"`
+}
@@ -1,8 +1,31 @@
 package models
 
+import "time"
+
 type Wallet struct {
 	Generic
 
 	Address      string `gorm:"not null; unique" json:"address"`
 	IsFeeGranted bool   `gorm:"index; not null; default:false" json:"is_fee_granted"`
+
+	Tier              string     `gorm:"not null; default:'FREE'" json:"tier"`
+	FeeGrantPolicy    *string    `json:"fee_grant_policy"`
+	FeeGrantExpiresAt *time.Time `gorm:"index" json:"fee_grant_expires_at"`
+	FeeGrantRevokedAt *time.Time `json:"fee_grant_revoked_at"`
+	LastSeenAt        *time.Time `gorm:"index" json:"last_seen_at"`
+
+	PlanSubscriptionID     *int64     `json:"plan_subscription_id"`
+	PlanSubscriptionStatus string     `gorm:"index; not null; default:'PENDING'" json:"plan_subscription_status"`
+	PlanAllocatedAt        *time.Time `json:"plan_allocated_at"`
+
+	PlanAllocationAttempts    int        `gorm:"not null; default:0" json:"-"`
+	PlanAllocationAttemptedAt *time.Time `json:"-"`
+	PlanAllocationError       *string    `json:"-"`
+
+	ReferralCode *string `gorm:"unique" json:"referral_code"`
+
+	DeregisteredAt *time.Time `gorm:"index" json:"deregistered_at"`
+
+	RegistrationIP     *string `gorm:"type:inet; index" json:"-"`
+	RegistrationSubnet *string `gorm:"type:cidr; index" json:"-"`
 }
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// UsedWalletSignature keeps the hash of a wallet request signature until the signature expires,
+// so a captured request cannot be replayed.
+type UsedWalletSignature struct {
+	Generic
+
+	Hash      string    `gorm:"not null; unique" json:"hash"`
+	ExpiresAt time.Time `gorm:"index; not null" json:"expires_at"`
+}
@@ -2,24 +2,80 @@ package routers
 
 import (
 	"dvpn/controllers"
+	"dvpn/internal/address"
+	"dvpn/internal/walletauth"
+	"dvpn/middleware"
 	"github.com/gin-gonic/gin"
 )
 
 type Router struct {
-	HealthController *controllers.HealthController
-	VPNController    *controllers.VPNController
-	WalletController *controllers.WalletController
+	HealthController  *controllers.HealthController
+	VPNController     *controllers.VPNController
+	WalletController  *controllers.WalletController
+	ProfileController *controllers.ProfileController
+	AdminController   *controllers.AdminController
+	CatalogController *controllers.CatalogController
+	VoucherController *controllers.VoucherController
+	ProductController *controllers.ProductController
+
+	AdminAuth        string
+	AddressPrefixes  address.Prefixes
+	WalletSignatures *walletauth.SignatureStore
 }
 
 func (r Router) RegisterRoutes(router gin.IRouter) {
 	router.GET("/health", r.HealthController.Status)
 	router.GET("/version", r.HealthController.Version)
 	router.GET("/ip", r.VPNController.GetIPAddress)
+	router.GET("/protocols", r.VPNController.GetProtocols)
+	router.GET("/catalog/latest", r.CatalogController.GetLatest)
 	router.GET("/countries", r.VPNController.GetCountries)
 	router.GET("/countries/:country_id/cities", r.VPNController.GetCities)
 	router.GET("/countries/:country_id/cities/:city_id/servers", r.VPNController.GetServers)
+	router.GET("/servers/recommended", r.VPNController.GetRecommendedServers)
+	router.GET("/servers/versions", r.VPNController.GetServerVersions)
+	router.GET("/servers/changes", r.VPNController.GetServerChanges)
 	router.POST("/servers", r.VPNController.GetServersByIds)
+	router.GET("/servers/:address", r.VPNController.GetServer)
+	router.POST("/servers/:address/reports", r.VPNController.SubmitConnectionReport)
+	router.GET("/products", r.ProductController.GetProducts)
+	router.GET("/wallet/challenge", r.WalletController.GetRegistrationChallenge)
 	router.POST("/wallet", r.WalletController.RegisterWallet)
 
+	wallet := router.Group("/wallet/:address", middleware.RequireWalletSignature(r.AddressPrefixes.Account, r.WalletSignatures))
+	wallet.GET("", r.WalletController.GetWalletStatus)
+	wallet.DELETE("", r.WalletController.DeregisterWallet)
+	wallet.GET("/referrals", r.WalletController.GetReferrals)
+	wallet.POST("/vouchers", r.VoucherController.RedeemVoucher)
+	wallet.GET("/favorites", r.ProfileController.GetFavorites)
+	wallet.PUT("/favorites", r.ProfileController.SetFavorites)
+	wallet.POST("/favorites/:server_address", r.ProfileController.AddFavorite)
+	wallet.DELETE("/favorites/:server_address", r.ProfileController.RemoveFavorite)
+	wallet.GET("/recents", r.ProfileController.GetRecents)
+	wallet.POST("/recents", r.ProfileController.AddRecent)
+	wallet.GET("/preferences", r.ProfileController.GetPreferences)
+	wallet.PUT("/preferences", r.ProfileController.SetPreferences)
+
 	router.POST("/rc-webhook", r.WalletController.HandleRevenueCatWebhook)
+
+	admin := router.Group("/admin", middleware.RequireAuthorization(r.AdminAuth))
+	admin.GET("/ban-policy/report", r.AdminController.GetBanPolicyReport)
+	admin.GET("/blocked-subnets", r.AdminController.GetBlockedSubnets)
+	admin.POST("/blocked-subnets", r.AdminController.BlockSubnet)
+	admin.DELETE("/blocked-subnets/:subnet_id", r.AdminController.UnblockSubnet)
+	admin.POST("/networks/import", r.AdminController.ImportNetworks)
+	admin.GET("/cities/:city_id/translations", r.AdminController.GetCityTranslations)
+	admin.PUT("/cities/:city_id/translations", r.AdminController.SetCityTranslations)
+	admin.GET("/registrations/rejections", r.AdminController.GetRegistrationRejections)
+	admin.GET("/registrations/anomalies", r.AdminController.GetRegistrationAnomalies)
+	admin.POST("/wallets/:address/deregister", r.AdminController.DeregisterWallet)
+	admin.GET("/wallet-revocations", r.AdminController.GetWalletRevocations)
+	admin.GET("/referrals/report", r.AdminController.GetReferralReport)
+	admin.GET("/voucher-batches", r.VoucherController.GetBatches)
+	admin.POST("/voucher-batches", r.VoucherController.CreateBatch)
+	admin.GET("/voucher-batches/:batch_id/export", r.VoucherController.ExportBatch)
+	admin.GET("/products", r.ProductController.GetAdminProducts)
+	admin.POST("/products", r.ProductController.CreateProduct)
+	admin.PUT("/products/:product_id", r.ProductController.UpdateProduct)
+	admin.DELETE("/products/:product_id", r.ProductController.RetireProduct)
 }